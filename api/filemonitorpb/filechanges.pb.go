@@ -0,0 +1,349 @@
+// File change notifications pushed by the FileMonitor controller, for
+// consumers that would rather not poll FileMonitor status.
+//
+// Regenerate the Go bindings after editing with:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	  --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//	  api/filemonitorpb/filechanges.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v6.33.0
+// source: api/filemonitorpb/filechanges.proto
+
+package filemonitorpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ChangeType int32
+
+const (
+	ChangeType_CHANGE_TYPE_UNSPECIFIED ChangeType = 0
+	ChangeType_CHANGE_TYPE_ADDED       ChangeType = 1
+	ChangeType_CHANGE_TYPE_MODIFIED    ChangeType = 2
+	ChangeType_CHANGE_TYPE_REMOVED     ChangeType = 3
+)
+
+// Enum value maps for ChangeType.
+var (
+	ChangeType_name = map[int32]string{
+		0: "CHANGE_TYPE_UNSPECIFIED",
+		1: "CHANGE_TYPE_ADDED",
+		2: "CHANGE_TYPE_MODIFIED",
+		3: "CHANGE_TYPE_REMOVED",
+	}
+	ChangeType_value = map[string]int32{
+		"CHANGE_TYPE_UNSPECIFIED": 0,
+		"CHANGE_TYPE_ADDED":       1,
+		"CHANGE_TYPE_MODIFIED":    2,
+		"CHANGE_TYPE_REMOVED":     3,
+	}
+)
+
+func (x ChangeType) Enum() *ChangeType {
+	p := new(ChangeType)
+	*p = x
+	return p
+}
+
+func (x ChangeType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ChangeType) Descriptor() protoreflect.EnumDescriptor {
+	return file_api_filemonitorpb_filechanges_proto_enumTypes[0].Descriptor()
+}
+
+func (ChangeType) Type() protoreflect.EnumType {
+	return &file_api_filemonitorpb_filechanges_proto_enumTypes[0]
+}
+
+func (x ChangeType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ChangeType.Descriptor instead.
+func (ChangeType) EnumDescriptor() ([]byte, []int) {
+	return file_api_filemonitorpb_filechanges_proto_rawDescGZIP(), []int{0}
+}
+
+type WatchFileChangesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// namespace restricts the stream to FileMonitors in this namespace. Empty
+	// means all namespaces.
+	Namespace string `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	// name restricts the stream to the FileMonitor with this name. Empty means
+	// every FileMonitor.
+	Name          string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchFileChangesRequest) Reset() {
+	*x = WatchFileChangesRequest{}
+	mi := &file_api_filemonitorpb_filechanges_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchFileChangesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchFileChangesRequest) ProtoMessage() {}
+
+func (x *WatchFileChangesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_filemonitorpb_filechanges_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchFileChangesRequest.ProtoReflect.Descriptor instead.
+func (*WatchFileChangesRequest) Descriptor() ([]byte, []int) {
+	return file_api_filemonitorpb_filechanges_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *WatchFileChangesRequest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *WatchFileChangesRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// FileChangeEvent is one difference between consecutive scans of a
+// FileMonitor, as also recorded in its status.lastChanges.
+type FileChangeEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// namespace and name identify the FileMonitor.
+	Namespace string `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Name      string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// path is the logical path that changed.
+	Path       string     `protobuf:"bytes,3,opt,name=path,proto3" json:"path,omitempty"`
+	ChangeType ChangeType `protobuf:"varint,4,opt,name=change_type,json=changeType,proto3,enum=sentinalfs.filemonitor.v1.ChangeType" json:"change_type,omitempty"`
+	// time is when the scan that detected the change finished.
+	Time *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=time,proto3" json:"time,omitempty"`
+	// old_size and new_size are set on a modified change when the size of the
+	// file changed.
+	OldSize *int64 `protobuf:"varint,6,opt,name=old_size,json=oldSize,proto3,oneof" json:"old_size,omitempty"`
+	NewSize *int64 `protobuf:"varint,7,opt,name=new_size,json=newSize,proto3,oneof" json:"new_size,omitempty"`
+	// old_mod_time and new_mod_time are set instead when only the
+	// modification time changed.
+	OldModTime    *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=old_mod_time,json=oldModTime,proto3" json:"old_mod_time,omitempty"`
+	NewModTime    *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=new_mod_time,json=newModTime,proto3" json:"new_mod_time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileChangeEvent) Reset() {
+	*x = FileChangeEvent{}
+	mi := &file_api_filemonitorpb_filechanges_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileChangeEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileChangeEvent) ProtoMessage() {}
+
+func (x *FileChangeEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_api_filemonitorpb_filechanges_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileChangeEvent.ProtoReflect.Descriptor instead.
+func (*FileChangeEvent) Descriptor() ([]byte, []int) {
+	return file_api_filemonitorpb_filechanges_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FileChangeEvent) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *FileChangeEvent) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FileChangeEvent) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *FileChangeEvent) GetChangeType() ChangeType {
+	if x != nil {
+		return x.ChangeType
+	}
+	return ChangeType_CHANGE_TYPE_UNSPECIFIED
+}
+
+func (x *FileChangeEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *FileChangeEvent) GetOldSize() int64 {
+	if x != nil && x.OldSize != nil {
+		return *x.OldSize
+	}
+	return 0
+}
+
+func (x *FileChangeEvent) GetNewSize() int64 {
+	if x != nil && x.NewSize != nil {
+		return *x.NewSize
+	}
+	return 0
+}
+
+func (x *FileChangeEvent) GetOldModTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.OldModTime
+	}
+	return nil
+}
+
+func (x *FileChangeEvent) GetNewModTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.NewModTime
+	}
+	return nil
+}
+
+var File_api_filemonitorpb_filechanges_proto protoreflect.FileDescriptor
+
+const file_api_filemonitorpb_filechanges_proto_rawDesc = "" +
+	"\n" +
+	"#api/filemonitorpb/filechanges.proto\x12\x19sentinalfs.filemonitor.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"K\n" +
+	"\x17WatchFileChangesRequest\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"\xa5\x03\n" +
+	"\x0fFileChangeEvent\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12\x12\n" +
+	"\x04path\x18\x03 \x01(\tR\x04path\x12F\n" +
+	"\vchange_type\x18\x04 \x01(\x0e2%.sentinalfs.filemonitor.v1.ChangeTypeR\n" +
+	"changeType\x12.\n" +
+	"\x04time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x1e\n" +
+	"\bold_size\x18\x06 \x01(\x03H\x00R\aoldSize\x88\x01\x01\x12\x1e\n" +
+	"\bnew_size\x18\a \x01(\x03H\x01R\anewSize\x88\x01\x01\x12<\n" +
+	"\fold_mod_time\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"oldModTime\x12<\n" +
+	"\fnew_mod_time\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"newModTimeB\v\n" +
+	"\t_old_sizeB\v\n" +
+	"\t_new_size*s\n" +
+	"\n" +
+	"ChangeType\x12\x1b\n" +
+	"\x17CHANGE_TYPE_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11CHANGE_TYPE_ADDED\x10\x01\x12\x18\n" +
+	"\x14CHANGE_TYPE_MODIFIED\x10\x02\x12\x17\n" +
+	"\x13CHANGE_TYPE_REMOVED\x10\x032\x83\x01\n" +
+	"\vFileChanges\x12t\n" +
+	"\x10WatchFileChanges\x122.sentinalfs.filemonitor.v1.WatchFileChangesRequest\x1a*.sentinalfs.filemonitor.v1.FileChangeEvent0\x01BFZDgithub.com/SentinalFS/file-monitor-kube-controller/api/filemonitorpbb\x06proto3"
+
+var (
+	file_api_filemonitorpb_filechanges_proto_rawDescOnce sync.Once
+	file_api_filemonitorpb_filechanges_proto_rawDescData []byte
+)
+
+func file_api_filemonitorpb_filechanges_proto_rawDescGZIP() []byte {
+	file_api_filemonitorpb_filechanges_proto_rawDescOnce.Do(func() {
+		file_api_filemonitorpb_filechanges_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_api_filemonitorpb_filechanges_proto_rawDesc), len(file_api_filemonitorpb_filechanges_proto_rawDesc)))
+	})
+	return file_api_filemonitorpb_filechanges_proto_rawDescData
+}
+
+var file_api_filemonitorpb_filechanges_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_api_filemonitorpb_filechanges_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_api_filemonitorpb_filechanges_proto_goTypes = []any{
+	(ChangeType)(0),                 // 0: sentinalfs.filemonitor.v1.ChangeType
+	(*WatchFileChangesRequest)(nil), // 1: sentinalfs.filemonitor.v1.WatchFileChangesRequest
+	(*FileChangeEvent)(nil),         // 2: sentinalfs.filemonitor.v1.FileChangeEvent
+	(*timestamppb.Timestamp)(nil),   // 3: google.protobuf.Timestamp
+}
+var file_api_filemonitorpb_filechanges_proto_depIdxs = []int32{
+	0, // 0: sentinalfs.filemonitor.v1.FileChangeEvent.change_type:type_name -> sentinalfs.filemonitor.v1.ChangeType
+	3, // 1: sentinalfs.filemonitor.v1.FileChangeEvent.time:type_name -> google.protobuf.Timestamp
+	3, // 2: sentinalfs.filemonitor.v1.FileChangeEvent.old_mod_time:type_name -> google.protobuf.Timestamp
+	3, // 3: sentinalfs.filemonitor.v1.FileChangeEvent.new_mod_time:type_name -> google.protobuf.Timestamp
+	1, // 4: sentinalfs.filemonitor.v1.FileChanges.WatchFileChanges:input_type -> sentinalfs.filemonitor.v1.WatchFileChangesRequest
+	2, // 5: sentinalfs.filemonitor.v1.FileChanges.WatchFileChanges:output_type -> sentinalfs.filemonitor.v1.FileChangeEvent
+	5, // [5:6] is the sub-list for method output_type
+	4, // [4:5] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_api_filemonitorpb_filechanges_proto_init() }
+func file_api_filemonitorpb_filechanges_proto_init() {
+	if File_api_filemonitorpb_filechanges_proto != nil {
+		return
+	}
+	file_api_filemonitorpb_filechanges_proto_msgTypes[1].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_filemonitorpb_filechanges_proto_rawDesc), len(file_api_filemonitorpb_filechanges_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_api_filemonitorpb_filechanges_proto_goTypes,
+		DependencyIndexes: file_api_filemonitorpb_filechanges_proto_depIdxs,
+		EnumInfos:         file_api_filemonitorpb_filechanges_proto_enumTypes,
+		MessageInfos:      file_api_filemonitorpb_filechanges_proto_msgTypes,
+	}.Build()
+	File_api_filemonitorpb_filechanges_proto = out.File
+	file_api_filemonitorpb_filechanges_proto_goTypes = nil
+	file_api_filemonitorpb_filechanges_proto_depIdxs = nil
+}
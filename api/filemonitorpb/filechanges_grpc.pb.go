@@ -0,0 +1,145 @@
+// File change notifications pushed by the FileMonitor controller, for
+// consumers that would rather not poll FileMonitor status.
+//
+// Regenerate the Go bindings after editing with:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	  --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+//	  api/filemonitorpb/filechanges.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             v6.33.0
+// source: api/filemonitorpb/filechanges.proto
+
+package filemonitorpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	FileChanges_WatchFileChanges_FullMethodName = "/sentinalfs.filemonitor.v1.FileChanges/WatchFileChanges"
+)
+
+// FileChangesClient is the client API for FileChanges service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// FileChanges streams the changes the controller detects as it reconciles
+// FileMonitors.
+type FileChangesClient interface {
+	// WatchFileChanges streams every change detected from the time of the call
+	// until the client cancels it or the controller shuts down. Changes detected
+	// while nobody is watching are not replayed.
+	WatchFileChanges(ctx context.Context, in *WatchFileChangesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileChangeEvent], error)
+}
+
+type fileChangesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFileChangesClient(cc grpc.ClientConnInterface) FileChangesClient {
+	return &fileChangesClient{cc}
+}
+
+func (c *fileChangesClient) WatchFileChanges(ctx context.Context, in *WatchFileChangesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileChangeEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileChanges_ServiceDesc.Streams[0], FileChanges_WatchFileChanges_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchFileChangesRequest, FileChangeEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileChanges_WatchFileChangesClient = grpc.ServerStreamingClient[FileChangeEvent]
+
+// FileChangesServer is the server API for FileChanges service.
+// All implementations must embed UnimplementedFileChangesServer
+// for forward compatibility.
+//
+// FileChanges streams the changes the controller detects as it reconciles
+// FileMonitors.
+type FileChangesServer interface {
+	// WatchFileChanges streams every change detected from the time of the call
+	// until the client cancels it or the controller shuts down. Changes detected
+	// while nobody is watching are not replayed.
+	WatchFileChanges(*WatchFileChangesRequest, grpc.ServerStreamingServer[FileChangeEvent]) error
+	mustEmbedUnimplementedFileChangesServer()
+}
+
+// UnimplementedFileChangesServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFileChangesServer struct{}
+
+func (UnimplementedFileChangesServer) WatchFileChanges(*WatchFileChangesRequest, grpc.ServerStreamingServer[FileChangeEvent]) error {
+	return status.Error(codes.Unimplemented, "method WatchFileChanges not implemented")
+}
+func (UnimplementedFileChangesServer) mustEmbedUnimplementedFileChangesServer() {}
+func (UnimplementedFileChangesServer) testEmbeddedByValue()                     {}
+
+// UnsafeFileChangesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FileChangesServer will
+// result in compilation errors.
+type UnsafeFileChangesServer interface {
+	mustEmbedUnimplementedFileChangesServer()
+}
+
+func RegisterFileChangesServer(s grpc.ServiceRegistrar, srv FileChangesServer) {
+	// If the following call panics, it indicates UnimplementedFileChangesServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&FileChanges_ServiceDesc, srv)
+}
+
+func _FileChanges_WatchFileChanges_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchFileChangesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileChangesServer).WatchFileChanges(m, &grpc.GenericServerStream[WatchFileChangesRequest, FileChangeEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileChanges_WatchFileChangesServer = grpc.ServerStreamingServer[FileChangeEvent]
+
+// FileChanges_ServiceDesc is the grpc.ServiceDesc for FileChanges service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FileChanges_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sentinalfs.filemonitor.v1.FileChanges",
+	HandlerType: (*FileChangesServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchFileChanges",
+			Handler:       _FileChanges_WatchFileChanges_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "api/filemonitorpb/filechanges.proto",
+}
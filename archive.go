@@ -0,0 +1,134 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// isArchive reports whether path names a tar archive that spec.archiveMode
+// lists the entries of, judged by its extension.
+func isArchive(path string) bool {
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanArchive returns a FileInfo for the tar archive at the on-disk path root
+// and one for each entry it holds, built from the entry's header and recorded
+// under the archive's path, e.g. /logs/day.tar/app/out.log. Nothing is
+// extracted. A gzip-compressed archive is read through a decompressor. Only a
+// failure to stat or open root is returned as an error; an archive that
+// cannot be read to the end keeps the entries before the damage, and the
+// problem is reported in the result's corrupt list.
+func scanArchive(ctx context.Context, root string, opts scanOptions) (scanResult, error) {
+	if err := opts.throttle.wait(ctx); err != nil {
+		return scanResult{}, err
+	}
+	info, target, err := opts.stat(ctx, root)
+	if err != nil {
+		return scanResult{}, err
+	}
+	if opts.excluded(root) {
+		return scanResult{}, nil
+	}
+	result := scanResult{root: opts.logical(root)}
+	if opts.recorded(root, info) {
+		result.add(linkedFileInfo(ctx, root, target, info, opts))
+	}
+	if !info.Mode().IsRegular() {
+		return result, nil
+	}
+
+	f, err := os.Open(target)
+	if err != nil {
+		return scanResult{}, err
+	}
+	defer f.Close()
+
+	if err := readArchive(ctx, root, opts.throttle.reader(ctx, f), opts, &result); err != nil {
+		if ctx.Err() != nil {
+			return scanResult{}, ctx.Err()
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return scanResult{}, err
+		}
+		result.corrupt = append(result.corrupt, fmt.Sprintf("%s: %v", opts.logical(root), err))
+	}
+	return result, nil
+}
+
+// readArchive adds the entries of the tar stream r, read from the on-disk
+// archive root, to result.
+func readArchive(ctx context.Context, root string, r io.Reader, opts scanOptions, result *scanResult) error {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		// Cleaning against / keeps names like ../x inside the archive.
+		path := filepath.Join(root, filepath.Clean("/"+hdr.Name))
+		if path == root || opts.excluded(path) || opts.hidden(root, path) {
+			continue
+		}
+		info := hdr.FileInfo()
+		if !opts.recorded(path, info) {
+			continue
+		}
+		typ := fileType(info.Mode())
+		var linkTarget string
+		if hdr.Typeflag == tar.TypeSymlink {
+			linkTarget = hdr.Linkname
+		}
+		result.add(FileInfo{
+			Name:       filepath.Base(path),
+			Size:       hdr.Size,
+			ModTime:    hdr.ModTime,
+			IsDir:      typ == fileTypeDir,
+			Path:       opts.logical(path),
+			Type:       typ,
+			UID:        uint32(hdr.Uid),
+			GID:        uint32(hdr.Gid),
+			Mode:       info.Mode().String(),
+			Perm:       uint32(info.Mode().Perm()),
+			LinkTarget: linkTarget,
+			noBtime:    true,
+		})
+	}
+}
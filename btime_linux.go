@@ -0,0 +1,42 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// btimeSupported reports whether readBtime can return creation times on this
+// platform. Whether it does for a given file is up to its filesystem.
+const btimeSupported = true
+
+// statxUnavailable is set once statx(2) turns out to be missing, as on kernels
+// before 4.11 or under a seccomp profile that denies it, so that it is not
+// tried again for every file.
+var statxUnavailable atomic.Bool
+
+// readBtime returns the creation time of path, without following a final
+// symlink, as reported by statx(2). ok is false when the kernel or the
+// filesystem does not record creation times.
+func readBtime(path string) (btime time.Time, ok bool, err error) {
+	if statxUnavailable.Load() {
+		return time.Time{}, false, nil
+	}
+	var stx unix.Statx_t
+	err = unix.Statx(unix.AT_FDCWD, path, unix.AT_SYMLINK_NOFOLLOW|unix.AT_STATX_DONT_SYNC, unix.STATX_BTIME, &stx)
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EPERM) {
+		statxUnavailable.Store(true)
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if stx.Mask&unix.STATX_BTIME == 0 {
+		return time.Time{}, false, nil
+	}
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), true, nil
+}
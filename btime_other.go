@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import "time"
+
+// btimeSupported reports whether readBtime can return creation times on this
+// platform.
+const btimeSupported = false
+
+// readBtime never returns a creation time outside Linux.
+func readBtime(path string) (time.Time, bool, error) {
+	return time.Time{}, false, nil
+}
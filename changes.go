@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxLastChanges bounds status.lastChanges; older entries are dropped first.
+const maxLastChanges = 100
+
+// Values of FileChange.ChangeType.
+const (
+	changeAdded    = "added"
+	changeModified = "modified"
+	changeRemoved  = "removed"
+)
+
+// FileChange records a difference between two consecutive scans.
+type FileChange struct {
+	Path       string      `json:"path"`
+	ChangeType string      `json:"changeType"`
+	Time       metav1.Time `json:"time"`
+	// OldSize and NewSize are set on a modified change when the size of
+	// the file changed.
+	OldSize *int64 `json:"oldSize,omitempty"`
+	NewSize *int64 `json:"newSize,omitempty"`
+	// OldModTime and NewModTime are set instead when only the modification
+	// time changed.
+	OldModTime *metav1.Time `json:"oldModTime,omitempty"`
+	NewModTime *metav1.Time `json:"newModTime,omitempty"`
+}
+
+// message describes the change for an event.
+func (c FileChange) message() string {
+	switch {
+	case c.OldSize != nil && c.NewSize != nil:
+		return fmt.Sprintf("File %s was modified, size %d -> %d bytes (%+d)", c.Path, *c.OldSize, *c.NewSize, *c.NewSize-*c.OldSize)
+	case c.OldModTime != nil && c.NewModTime != nil:
+		return fmt.Sprintf("File %s was modified, modification time %s -> %s", c.Path,
+			c.OldModTime.UTC().Format(time.RFC3339Nano), c.NewModTime.UTC().Format(time.RFC3339Nano))
+	default:
+		return fmt.Sprintf("File %s was %s", c.Path, c.ChangeType)
+	}
+}
+
+// modifiedChange returns the modified change from old to f, detailing how
+// its size or, failing that, its modification time changed.
+func modifiedChange(old, f FileInfo, now metav1.Time) FileChange {
+	change := FileChange{Path: f.Path, ChangeType: changeModified, Time: now}
+	switch {
+	case old.Size != f.Size:
+		change.OldSize, change.NewSize = &old.Size, &f.Size
+	case !old.ModTime.Equal(f.ModTime):
+		oldModTime, newModTime := metav1.NewTime(old.ModTime), metav1.NewTime(f.ModTime)
+		change.OldModTime, change.NewModTime = &oldModTime, &newModTime
+	}
+	return change
+}
+
+// computeChanges compares the files of two scans by path. A path present in
+// both is modified when its inode, size, modification time or mode differs;
+// see modifiedChange for what is recorded about it.
+func computeChanges(previous, current []FileInfo, now metav1.Time) []FileChange {
+	before := make(map[string]FileInfo, len(previous))
+	for _, f := range previous {
+		before[f.Path] = f
+	}
+
+	var changes []FileChange
+	seen := make(map[string]struct{}, len(current))
+	for _, f := range current {
+		seen[f.Path] = struct{}{}
+		old, ok := before[f.Path]
+		switch {
+		case !ok:
+			changes = append(changes, FileChange{Path: f.Path, ChangeType: changeAdded, Time: now})
+		case old.Inode != f.Inode || old.Size != f.Size || !old.ModTime.Equal(f.ModTime),
+			old.Mode != "" && old.Mode != f.Mode:
+			changes = append(changes, modifiedChange(old, f, now))
+		}
+	}
+	for _, f := range previous {
+		if _, ok := seen[f.Path]; !ok {
+			changes = append(changes, FileChange{Path: f.Path, ChangeType: changeRemoved, Time: now})
+		}
+	}
+	return changes
+}
+
+// scanChanges returns the changes between previous and the files now in the
+// status of fm, stamped with the time of the scan that found them.
+func scanChanges(fm *FileMonitorCRD, previous []FileInfo) []FileChange {
+	now := metav1.Now()
+	if fm.Status.LastScanTime != nil {
+		now = *fm.Status.LastScanTime
+	}
+	return computeChanges(previous, fm.Status.Files, now)
+}
+
+// appendChanges appends changes to history, keeping only the newest
+// maxLastChanges entries.
+func appendChanges(history, changes []FileChange) []FileChange {
+	history = append(history, changes...)
+	if len(history) > maxLastChanges {
+		history = append([]FileChange(nil), history[len(history)-maxLastChanges:]...)
+	}
+	return history
+}
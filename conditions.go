@@ -0,0 +1,102 @@
+package main
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types recorded in status.conditions.
+const (
+	// conditionReady summarises the others: it is True once spec.path has
+	// been scanned and the result written to status.
+	conditionReady = "Ready"
+	// conditionPathAccessible reports whether spec.path is valid and could be
+	// reached.
+	conditionPathAccessible = "PathAccessible"
+	// conditionScanSucceeded reports whether the most recent scan completed.
+	conditionScanSucceeded = "ScanSucceeded"
+	// conditionDegraded is True while spec is unusable as written.
+	conditionDegraded = "Degraded"
+	// conditionInvalidSpec is True when spec fails the checks of the
+	// admission webhook, listing every problem, so that it is not scanned.
+	conditionInvalidSpec = "InvalidSpec"
+	// conditionTruncated is True when status.files omits entries beyond
+	// spec.maxFiles.
+	conditionTruncated = "Truncated"
+	// conditionScanIntervalValid is False when spec.scanInterval could not be
+	// used and the default interval applies instead.
+	conditionScanIntervalValid = "ScanIntervalValid"
+	// conditionNewerThanValid is False when spec.newerThan could not be used
+	// and no age limit was applied.
+	conditionNewerThanValid = "NewerThanValid"
+	// conditionSinceValid is False when spec.since could not be parsed and
+	// no cutoff was applied for it.
+	conditionSinceValid = "SinceValid"
+	// conditionContentMatchValid is False when spec.contentMatch does not
+	// compile and file contents were not matched.
+	conditionContentMatchValid = "ContentMatchValid"
+	// conditionScanTimedOut is True when the most recent scan was abandoned
+	// because it exceeded --reconcile-timeout.
+	conditionScanTimedOut = "ScanTimedOut"
+	// conditionContainerRunning reports whether the spec.containerName
+	// container of the spec.podName pod is running, so that its filesystem
+	// can be scanned.
+	conditionContainerRunning = "ContainerRunning"
+	// conditionTemplateError is True when spec.pathTemplate could not be
+	// rendered, so nothing was scanned.
+	conditionTemplateError = "TemplateError"
+	// conditionUnsupportedVolume is True when the volume bound to the
+	// spec.pvcName claim has no path on the node to scan.
+	conditionUnsupportedVolume = "UnsupportedVolume"
+	// conditionPaused is True while the sentinalfs.io/paused annotation
+	// stops the FileMonitor from being scanned.
+	conditionPaused = "Paused"
+	// conditionSuspended is True while spec.suspend stops the FileMonitor
+	// from being scanned.
+	conditionSuspended = "Suspended"
+	// conditionPatternsLoaded reports whether the patterns of
+	// spec.patternsFrom could be read. When False only the valid ones, if
+	// any, are scanned along with spec.path.
+	conditionPatternsLoaded = "PatternsLoaded"
+	// conditionArchiveReadable is False when spec.archiveMode is set and an
+	// archive could not be read to the end, so only the entries before the
+	// damage are listed.
+	conditionArchiveReadable = "ArchiveReadable"
+	// conditionConversionWarning is True when spec fields were dropped or
+	// overridden on conversion between FileMonitor versions; see
+	// convertSpec.
+	conditionConversionWarning = "ConversionWarning"
+)
+
+// setCondition adds or updates the condition of the given type on fm.
+// LastTransitionTime is only stamped when the status actually changes, so
+// repeated reconciles with the same outcome leave it alone. The condition's
+// observedGeneration is the generation of the spec it was computed from.
+func setCondition(fm *FileMonitorCRD, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&fm.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: fm.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// markScanned records a successful scan of spec.path.
+func markScanned(fm *FileMonitorCRD, message string) {
+	setCondition(fm, conditionPathAccessible, metav1.ConditionTrue, "Scanned", message)
+	setCondition(fm, conditionScanSucceeded, metav1.ConditionTrue, "Scanned", message)
+	setCondition(fm, conditionScanTimedOut, metav1.ConditionFalse, "Scanned", "the scan completed in time")
+	setCondition(fm, conditionDegraded, metav1.ConditionFalse, "Scanned", "spec is valid")
+	setCondition(fm, conditionReady, metav1.ConditionTrue, "Scanned", message)
+}
+
+// markScanFailed records that spec.path could not be scanned for reason and
+// stamps status.lastErrorTime.
+func markScanFailed(fm *FileMonitorCRD, reason, message string) {
+	now := metav1.Now()
+	fm.Status.LastErrorTime = &now
+	setCondition(fm, conditionPathAccessible, metav1.ConditionFalse, reason, message)
+	setCondition(fm, conditionScanSucceeded, metav1.ConditionFalse, reason, message)
+	setCondition(fm, conditionReady, metav1.ConditionFalse, reason, message)
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// defaultShutdownGracePeriod is the default for --shutdown-grace-period.
+const defaultShutdownGracePeriod = 30 * time.Second
+
+// defaultReconcileTimeout is the default for --reconcile-timeout.
+const defaultReconcileTimeout = 2 * time.Minute
+
+// defaultWorkers is the default for --workers.
+const defaultWorkers = 2
+
+// defaultMaxRetries is the default for --max-retries.
+const defaultMaxRetries = 15
+
+// defaultJitterFactor is the default for --jitter-factor.
+const defaultJitterFactor = 0.1
+
+// Config holds the controller's command-line configuration.
+type Config struct {
+	// Kubeconfig is the path to a kubeconfig file. When empty the default
+	// loading rules apply: $KUBECONFIG, ~/.kube/config, then in-cluster.
+	Kubeconfig string
+	// Namespaces restricts the controller to the listed namespaces. Empty
+	// means all namespaces.
+	Namespaces []string
+	// ResyncInterval is how often a FileMonitor without spec.scanInterval is
+	// re-reconciled.
+	ResyncInterval time.Duration
+	// ShutdownGracePeriod bounds how long an in-flight reconcile may run after
+	// a termination signal before it is cancelled.
+	ShutdownGracePeriod time.Duration
+	// ReconcileTimeout bounds a single reconcile, so that a hung scan cannot
+	// hold up every other FileMonitor.
+	ReconcileTimeout time.Duration
+	// Workers is how many FileMonitors are reconciled in parallel.
+	Workers int
+	// MaxRetries is how many consecutive failures of a FileMonitor are
+	// retried with backoff before it is marked Degraded.
+	MaxRetries int
+	// JitterFactor stretches each rescan delay by a random fraction of up to
+	// this much, and has the initial reconciles staggered across the first
+	// resync interval. Zero disables both.
+	JitterFactor float64
+	// MetricsAddr is the listen address of the Prometheus metrics server.
+	MetricsAddr string
+	// HealthAddr is the listen address of the /healthz and /readyz server.
+	HealthAddr string
+	// EnablePprof serves the net/http/pprof profiles on the health server.
+	EnablePprof bool
+	// EnableAdminEndpoints serves endpoints that act on the controller, such
+	// as POST /reconcile, on the health server.
+	EnableAdminEndpoints bool
+	// WebhookAddr is the listen address of the validating admission webhook.
+	WebhookAddr string
+	// WebhookCertFile and WebhookKeyFile are the TLS certificate and key the
+	// webhook is served with. The webhook is disabled when they are empty.
+	WebhookCertFile string
+	WebhookKeyFile  string
+	// GRPCAddr is the listen address of the FileChanges gRPC service. The
+	// service is disabled when it is empty.
+	GRPCAddr string
+	// WebSocketAddr is the listen address of the /ws/changes WebSocket
+	// stream. The stream is disabled when it is empty.
+	WebSocketAddr string
+	// ComputeHash records a SHA-256 of each regular file's contents.
+	ComputeHash bool
+	// MaxHashSize is the largest file, in bytes, that is hashed. Zero means no
+	// limit.
+	MaxHashSize int64
+	// HashCacheSize is how many file digests are remembered between scans,
+	// so that unchanged files are not read again. Zero disables the cache.
+	HashCacheSize int
+	// ScanIOPSLimit bounds the filesystem operations per second of all scans
+	// together. Zero disables throttling.
+	ScanIOPSLimit int
+	// HostRoot is where the node's root filesystem is mounted, e.g. /host in
+	// a DaemonSet. It is prepended to the spec.path of every FileMonitor not
+	// targeting a pod, whose files are still reported by their host path.
+	HostRoot string
+	// ForbiddenPaths lists directories no FileMonitor may scan, whether by
+	// naming them or something below them.
+	ForbiddenPaths []string
+	// LogLevel is the minimum level logged: debug, info, warn or error.
+	LogLevel string
+	// LeaderElect makes replicas campaign for a Lease so that only one of
+	// them reconciles at a time.
+	LeaderElect bool
+	// LeaderElectLeaseName is the name of the Lease used for leader election.
+	LeaderElectLeaseName string
+	// LeaderElectNamespace is the namespace of the Lease. Empty means the
+	// namespace the controller runs in.
+	LeaderElectNamespace string
+	// Debounce is the quiet period a FileMonitor's files must observe after a
+	// change notification before it is reconciled.
+	Debounce time.Duration
+	// ScanCooldown is how soon after a successful reconcile a FileMonitor
+	// may be reconciled again; see scanCooldown.
+	ScanCooldown time.Duration
+	// EventAggregateThreshold is how many files of each kind of change a
+	// reconcile records individual events for; more are counted in a single
+	// event. Zero means no limit.
+	EventAggregateThreshold int
+	// WatchMode selects how file changes are noticed between resyncs: "poll"
+	// relies on the resync interval alone, "inotify" additionally reconciles
+	// as soon as a watched directory changes.
+	WatchMode string
+	// InstallCRD applies the embedded FileMonitor CustomResourceDefinition on
+	// startup.
+	InstallCRD bool
+	// Once reconciles every FileMonitor a single time and exits, reporting
+	// failure if any of them failed or did not end up Ready.
+	Once bool
+	// SelfTestPath is the path the selftest subcommand checks can be read.
+	SelfTestPath string
+	// StatusWriteMode is how status is written: statusWriteApply or
+	// statusWriteJSONPatch.
+	StatusWriteMode string
+	// StatusBatchSize is the most entries of status.files sent in one
+	// request; see statusWriter.applyBatched. Zero sends them all at once.
+	StatusBatchSize int
+	// DryRun scans and logs the status each FileMonitor would get without
+	// writing it.
+	DryRun bool
+	// EmitNDJSON writes the files found by each scan to stdout as
+	// newline-delimited JSON.
+	EmitNDJSON bool
+	// EmitTarget is where scan results go under EmitNDJSON: emitTargetBoth
+	// or emitTargetStdout.
+	EmitTarget string
+	// ListPageSize is the maximum number of FileMonitors fetched per List
+	// request.
+	ListPageSize int64
+	// Selector restricts the controller to FileMonitors whose labels match.
+	// The empty selector matches every object.
+	Selector labels.Selector
+	// APIVersions lists the FileMonitor versions watched, most preferred
+	// first. Status is written back through the version an object was read
+	// as, and discovery checks use the first.
+	APIVersions []string
+}
+
+// namespaces returns the namespaces to watch, with a single
+// metav1.NamespaceAll standing for every namespace.
+func (cfg *Config) namespaces() []string {
+	if len(cfg.Namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return cfg.Namespaces
+}
+
+// parseNamespaces splits a comma-separated namespace list, dropping empty
+// entries and duplicates.
+func parseNamespaces(list string) ([]string, error) {
+	var namespaces []string
+	seen := make(map[string]bool)
+	for _, ns := range strings.Split(list, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" || seen[ns] {
+			continue
+		}
+		if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid namespace %q in --namespaces: %s", ns, strings.Join(errs, ", "))
+		}
+		seen[ns] = true
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces, nil
+}
+
+// parseForbiddenPaths splits a comma-separated list of absolute paths,
+// cleaning each one.
+func parseForbiddenPaths(list string) ([]string, error) {
+	var paths []string
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			return nil, fmt.Errorf("--forbidden-paths entry %q is not absolute", p)
+		}
+		paths = append(paths, filepath.Clean(p))
+	}
+	return paths, nil
+}
+
+// scanOptions returns the scanner settings carried by cfg.
+func (cfg *Config) scanOptions() scanOptions {
+	return scanOptions{
+		ComputeHash:    cfg.ComputeHash,
+		MaxHashSize:    cfg.MaxHashSize,
+		ForbiddenPaths: cfg.ForbiddenPaths,
+		Root:           cfg.HostRoot,
+		hashes:         newHashCache(cfg.HashCacheSize),
+		throttle:       newIOThrottle(cfg.ScanIOPSLimit),
+	}
+}
+
+// parseFlags parses args into a Config. Settings not given on the command
+// line are taken from the file named by --config, if any.
+func parseFlags(args []string) (*Config, error) {
+	cfg := &Config{}
+
+	fs := flag.NewFlagSet("file-monitor-kube-controller", flag.ContinueOnError)
+	var configFile string
+	fs.StringVar(&configFile, "config", "", "YAML or JSON file of settings, keyed by the camelCase form of each flag name, e.g. resyncInterval: 5m. Flags override the file.")
+	fs.StringVar(&cfg.Kubeconfig, "kubeconfig", "", "Path to a kubeconfig file. Defaults to $KUBECONFIG, ~/.kube/config, or in-cluster config.")
+	var namespace, namespaces string
+	fs.StringVar(&namespace, "namespace", "", "Single namespace to watch FileMonitors in. Deprecated: use --namespaces.")
+	fs.StringVar(&namespaces, "namespaces", "", "Comma-separated namespaces to watch FileMonitors in, e.g. team-a,team-b. Empty watches all namespaces.")
+	fs.DurationVar(&cfg.ResyncInterval, "resync-interval", defaultResyncPeriod, "How often a FileMonitor is re-reconciled when it does not set spec.scanInterval.")
+	fs.DurationVar(&cfg.ShutdownGracePeriod, "shutdown-grace-period", defaultShutdownGracePeriod, "How long to wait for an in-flight reconcile to finish after SIGINT or SIGTERM.")
+	fs.IntVar(&cfg.Workers, "workers", defaultWorkers, "Number of FileMonitors reconciled in parallel. The same FileMonitor is never reconciled by two workers at once.")
+	fs.IntVar(&cfg.MaxRetries, "max-retries", defaultMaxRetries, "Consecutive failed reconciles of a FileMonitor retried with backoff before it is marked Degraded and left until its spec changes or its scan interval elapses.")
+	fs.Float64Var(&cfg.JitterFactor, "jitter-factor", defaultJitterFactor, "Randomly lengthen each rescan delay by up to this fraction of it, and stagger the first reconcile of every FileMonitor across the resync interval, to spread API and filesystem load. 0 disables.")
+	fs.DurationVar(&cfg.ReconcileTimeout, "reconcile-timeout", defaultReconcileTimeout, "Maximum time a single reconcile, including its scan, may take before it is abandoned and retried.")
+
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", defaultMetricsAddr, "Address to serve Prometheus metrics and "+recentErrorsPath+" on.")
+
+	fs.StringVar(&cfg.HealthAddr, "health-addr", defaultHealthAddr, "Address to serve /healthz and /readyz on.")
+	fs.BoolVar(&cfg.EnableAdminEndpoints, "enable-admin-endpoints", false, "Serve POST "+adminReconcilePath+"?namespace=X&name=Y on --health-addr, which reconciles that FileMonitor straight away. Anyone who can reach the port can trigger scans.")
+	fs.BoolVar(&cfg.EnablePprof, "enable-pprof", false, "Serve net/http/pprof profiles under /debug/pprof/ on --health-addr. For slow scans start with profile (CPU), goroutine?debug=2 (blocked workers) and heap.")
+
+	fs.StringVar(&cfg.WebhookAddr, "webhook-addr", defaultWebhookAddr, "Address to serve the FileMonitor validating admission webhook on.")
+	fs.StringVar(&cfg.WebhookCertFile, "webhook-cert-file", "", "TLS certificate for the validating webhook. The webhook is only served when set.")
+	fs.StringVar(&cfg.WebhookKeyFile, "webhook-key-file", "", "TLS private key for the validating webhook.")
+
+	fs.StringVar(&cfg.GRPCAddr, "grpc-addr", "", "Address to serve the FileChanges gRPC stream of detected file changes on, e.g. :9090. Disabled when empty.")
+	fs.StringVar(&cfg.WebSocketAddr, "websocket-addr", "", "Address to serve the "+webSocketPath+" WebSocket stream of detected file changes on, e.g. :8082. Disabled when empty.")
+
+	fs.BoolVar(&cfg.ComputeHash, "compute-hash", false, "Record a SHA-256 of every regular file's contents.")
+	fs.Int64Var(&cfg.MaxHashSize, "max-hash-size", defaultMaxHashSize, "Skip hashing files larger than this many bytes. 0 means no limit.")
+	fs.IntVar(&cfg.HashCacheSize, "hash-cache-size", defaultHashCacheSize, "Number of file digests kept between scans, keyed by inode, size and modification time, so unchanged files are not rehashed. 0 disables the cache.")
+
+	fs.IntVar(&cfg.ScanIOPSLimit, "scan-iops-limit", 0, "Maximum filesystem operations per second across all scans: one per entry stat'ed and one per 64KiB read when hashing or matching contents. 0 disables throttling.")
+
+	fs.StringVar(&cfg.LogLevel, "log-level", defaultLogLevel, "Minimum log level: debug, info, warn or error. Per-file messages are logged at debug.")
+
+	fs.BoolVar(&cfg.LeaderElect, "leader-elect", false, "Elect a leader among replicas so only one reconciles FileMonitors.")
+	fs.StringVar(&cfg.LeaderElectLeaseName, "leader-elect-lease-name", defaultLeaseName, "Name of the Lease used for leader election.")
+	fs.StringVar(&cfg.LeaderElectNamespace, "leader-elect-namespace", "", "Namespace of the leader election Lease. Defaults to the controller's own namespace.")
+
+	fs.DurationVar(&cfg.Debounce, "debounce", defaultDebounce, "Quiet period after a filesystem change before the FileMonitor is reconciled; 0 disables debouncing.")
+
+	fs.DurationVar(&cfg.ScanCooldown, "scan-cooldown", defaultScanCooldown, "How long after a successful reconcile a FileMonitor queued again waits before being rescanned; a duplicate with nothing new since is dropped. 0 disables the cooldown.")
+
+	fs.IntVar(&cfg.EventAggregateThreshold, "event-aggregate-threshold", defaultEventAggregateThreshold, "Record an event per file for at most this many files added, removed, modified or found large by one scan; more are reported in one event such as \"47 files were added\". 0 means no limit.")
+
+	fs.StringVar(&cfg.WatchMode, "watch-mode", watchModePoll, "How file changes are detected: poll (resync interval only) or inotify.")
+
+	fs.BoolVar(&cfg.InstallCRD, "install-crd", false, "Create or update the FileMonitor CustomResourceDefinition on startup. Requires permission to manage CRDs.")
+	fs.BoolVar(&cfg.Once, "once", false, "Reconcile every matching FileMonitor once and exit: 0 if all ended Ready, 1 if any failed or did not.")
+	fs.StringVar(&cfg.SelfTestPath, "selftest-path", "", "Path the "+selfTestCommand+" subcommand checks the controller can read. Defaults to the spec.path of the FileMonitor it reads back.")
+	fs.IntVar(&cfg.StatusBatchSize, "status-batch-size", 0, "Write status.files in batches of at most this many entries, with status.scanning set until the last one, for trees whose status would exceed the API server's request size limit. 0 writes it in one request.")
+	fs.StringVar(&cfg.StatusWriteMode, "status-write-mode", statusWriteApply, "How FileMonitor status is written: apply sends all of it with server-side apply; json-patch sends a JSON Patch of what changed, or a full update when that is smaller.")
+	fs.BoolVar(&cfg.DryRun, "dry-run", false, "Scan and log the resulting status as JSON without writing it to the API server.")
+	fs.BoolVar(&cfg.EmitNDJSON, "emit-ndjson", false, "Write every file found by each scan to stdout as a line of JSON with its namespace and FileMonitor, e.g. for Fluent Bit.")
+	fs.StringVar(&cfg.EmitTarget, "emit-target", emitTargetBoth, "Where --emit-ndjson scan results go: both (stdout and status) or stdout (status is not written).")
+
+	fs.Int64Var(&cfg.ListPageSize, "list-page-size", defaultListPageSize, "Maximum number of FileMonitors fetched per List request.")
+
+	fs.StringVar(&cfg.HostRoot, "host-root", "", "Directory the node's root filesystem is mounted at, e.g. /host, prepended to every spec.path not inside a pod. Status reports the path on the node. Empty scans the controller's own filesystem.")
+
+	var forbidden string
+	fs.StringVar(&forbidden, "forbidden-paths", defaultForbiddenPaths, "Comma-separated absolute paths that no spec.path may be or lie under. \"/\" only forbids the root itself. Empty forbids nothing.")
+
+	var apiVersions string
+	fs.StringVar(&apiVersions, "api-versions", fileMonitorV1, "Comma-separated FileMonitor versions to watch, most preferred first: "+fileMonitorV1+", "+fileMonitorV1beta1+" or both, e.g. while migrating. An object seen through both is read as the first.")
+
+	var selector string
+	fs.StringVar(&selector, "selector", "", "Label selector, e.g. team=platform; only matching FileMonitors are reconciled. Empty matches all.")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if configFile != "" {
+		if err := loadConfigFile(fs, configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if cfg.Namespaces, err = parseNamespaces(namespace + "," + namespaces); err != nil {
+		return nil, err
+	}
+	if cfg.ForbiddenPaths, err = parseForbiddenPaths(forbidden); err != nil {
+		return nil, err
+	}
+	if cfg.Selector, err = labels.Parse(selector); err != nil {
+		return nil, fmt.Errorf("invalid --selector %q: %w", selector, err)
+	}
+	if cfg.APIVersions, err = parseAPIVersions(apiVersions); err != nil {
+		return nil, err
+	}
+	if cfg.ResyncInterval <= 0 {
+		return nil, fmt.Errorf("--resync-interval must be positive, got %s", cfg.ResyncInterval)
+	}
+
+	if cfg.ListPageSize <= 0 {
+		return nil, fmt.Errorf("--list-page-size must be positive, got %d", cfg.ListPageSize)
+	}
+	if cfg.MaxHashSize < 0 {
+		return nil, fmt.Errorf("--max-hash-size must not be negative, got %d", cfg.MaxHashSize)
+	}
+	if cfg.HostRoot != "" {
+		if !filepath.IsAbs(cfg.HostRoot) {
+			return nil, fmt.Errorf("--host-root must be an absolute path, got %q", cfg.HostRoot)
+		}
+		if cfg.HostRoot = filepath.Clean(cfg.HostRoot); cfg.HostRoot == "/" {
+			cfg.HostRoot = ""
+		}
+	}
+	if cfg.ScanIOPSLimit < 0 {
+		return nil, fmt.Errorf("--scan-iops-limit must not be negative, got %d", cfg.ScanIOPSLimit)
+	}
+	if cfg.HashCacheSize < 0 {
+		return nil, fmt.Errorf("--hash-cache-size must not be negative, got %d", cfg.HashCacheSize)
+	}
+	if cfg.StatusBatchSize < 0 {
+		return nil, fmt.Errorf("--status-batch-size must not be negative, got %d", cfg.StatusBatchSize)
+	}
+	if cfg.StatusWriteMode != statusWriteApply && cfg.StatusWriteMode != statusWriteJSONPatch {
+		return nil, fmt.Errorf("--status-write-mode must be %q or %q, got %q", statusWriteApply, statusWriteJSONPatch, cfg.StatusWriteMode)
+	}
+	if cfg.EmitTarget != emitTargetBoth && cfg.EmitTarget != emitTargetStdout {
+		return nil, fmt.Errorf("--emit-target must be %q or %q, got %q", emitTargetBoth, emitTargetStdout, cfg.EmitTarget)
+	}
+	if cfg.EmitTarget == emitTargetStdout && !cfg.EmitNDJSON {
+		return nil, fmt.Errorf("--emit-target=%s requires --emit-ndjson", emitTargetStdout)
+	}
+	if cfg.WatchMode != watchModePoll && cfg.WatchMode != watchModeInotify {
+		return nil, fmt.Errorf("--watch-mode must be %q or %q, got %q", watchModePoll, watchModeInotify, cfg.WatchMode)
+	}
+	if cfg.Debounce < 0 {
+		return nil, fmt.Errorf("--debounce must not be negative, got %s", cfg.Debounce)
+	}
+	if cfg.ScanCooldown < 0 {
+		return nil, fmt.Errorf("--scan-cooldown must not be negative, got %s", cfg.ScanCooldown)
+	}
+	if cfg.EventAggregateThreshold < 0 {
+		return nil, fmt.Errorf("--event-aggregate-threshold must not be negative, got %d", cfg.EventAggregateThreshold)
+	}
+	if cfg.ShutdownGracePeriod < 0 {
+		return nil, fmt.Errorf("--shutdown-grace-period must not be negative, got %s", cfg.ShutdownGracePeriod)
+	}
+	if (cfg.WebhookCertFile == "") != (cfg.WebhookKeyFile == "") {
+		return nil, fmt.Errorf("--webhook-cert-file and --webhook-key-file must be set together")
+	}
+	if cfg.Workers <= 0 {
+		return nil, fmt.Errorf("--workers must be positive, got %d", cfg.Workers)
+	}
+	if cfg.MaxRetries <= 0 {
+		return nil, fmt.Errorf("--max-retries must be positive, got %d", cfg.MaxRetries)
+	}
+	if cfg.JitterFactor < 0 {
+		return nil, fmt.Errorf("--jitter-factor must not be negative, got %g", cfg.JitterFactor)
+	}
+	if cfg.ReconcileTimeout <= 0 {
+		return nil, fmt.Errorf("--reconcile-timeout must be positive, got %s", cfg.ReconcileTimeout)
+	}
+
+	return cfg, nil
+}
+
+// loadConfigFile applies the settings in the YAML or JSON file at path to the
+// flags of fs that were not set on the command line. Each key is the camelCase
+// form of a flag name and its value is parsed exactly as the flag would be, so
+// the file is validated along with the flags.
+func loadConfigFile(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("config file %s is not valid YAML or JSON: %w", path, err)
+	}
+
+	var values map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return fmt.Errorf("config file %s must contain a mapping of settings: %w", path, err)
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := flagName(key)
+		if name == "config" || fs.Lookup(name) == nil {
+			return fmt.Errorf("config file %s: unknown setting %q", path, key)
+		}
+		if explicit[name] {
+			continue
+		}
+
+		var value string
+		switch v := values[key].(type) {
+		case string:
+			value = v
+		case bool, json.Number:
+			value = fmt.Sprint(v)
+		default:
+			return fmt.Errorf("config file %s: setting %q must be a string, number or boolean", path, key)
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("config file %s: invalid value %q for %s: %w", path, value, key, err)
+		}
+	}
+	return nil
+}
+
+// flagName converts a camelCase config file key to the flag it sets, e.g.
+// resyncInterval to resync-interval.
+func flagName(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+)
+
+// defaultContentMatchMaxSize is the spec.contentMatchMaxSize applied when the
+// field is unset.
+const defaultContentMatchMaxSize = 1 << 20
+
+// binarySniffSize is how much of a file is checked for NUL bytes before its
+// contents are matched, the same amount git looks at.
+const binarySniffSize = 8000
+
+// maxContentMatchLine bounds the length of a line matched against
+// spec.contentMatch; matching a file stops at a longer line.
+const maxContentMatchLine = 1 << 20
+
+// matchContent returns the number of the first line of path that re matches,
+// counting from one, or zero when none does. Files that look binary, holding
+// a NUL byte near the start, are not matched. Reads are paced by throttle.
+func matchContent(ctx context.Context, path string, re *regexp.Regexp, throttle *ioThrottle) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(throttle.reader(ctx, f), binarySniffSize)
+	head, err := r.Peek(binarySniffSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return 0, nil
+	}
+
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 0, 64<<10), maxContentMatchLine)
+	for n := 1; lines.Scan(); n++ {
+		if re.Match(lines.Bytes()) {
+			return n, nil
+		}
+	}
+	return 0, lines.Err()
+}
+
+// contentLines maps the paths of matches to their line numbers.
+func contentLines(matches []ContentMatch) map[string]int {
+	if len(matches) == 0 {
+		return nil
+	}
+	lines := make(map[string]int, len(matches))
+	for _, m := range matches {
+		lines[m.Path] = m.Line
+	}
+	return lines
+}
@@ -0,0 +1,836 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// defaultResyncPeriod is how often a FileMonitor is re-reconciled even when
+// nothing about the object has changed, so that file changes are picked up
+// periodically. spec.scanInterval overrides it per object.
+const defaultResyncPeriod = 30 * time.Second
+
+// Controller watches FileMonitor objects and reconciles each one whose key is
+// placed on its work queue.
+type Controller struct {
+	log           logr.Logger
+	clientset     kubernetes.Interface
+	dynamicClient dynamic.Interface
+	status        *statusWriter
+	// factories holds one informer factory per watched namespace, and
+	// informers the FileMonitor informers of each, keyed by namespace, one
+	// per watched version in order of preference. metav1.NamespaceAll is the
+	// only key when every namespace is watched.
+	factories []dynamicinformer.DynamicSharedInformerFactory
+	informers map[string][]cache.SharedIndexInformer
+	// versions lists the FileMonitor versions watched, most preferred first.
+	versions    []string
+	queue       workqueue.TypedRateLimitingInterface[string]
+	recorder    record.EventRecorder
+	broadcaster record.EventBroadcaster
+	// eventThreshold is how many files of each kind of change one reconcile
+	// records an event for before recording a single one counting them
+	// instead; zero means no limit.
+	eventThreshold int
+	scanOpts       scanOptions
+	// interval is how long after a reconcile an object without
+	// spec.scanInterval is scanned again.
+	interval time.Duration
+	// reconcileTimeout bounds each call to reconcile.
+	reconcileTimeout time.Duration
+	// workers is how many goroutines process the work queue. The queue never
+	// hands the same key to two of them at once.
+	workers int
+	// maxRetries is how many consecutive failures of a key are retried with
+	// backoff before giving up on it.
+	maxRetries int
+	// missing counts, by key, the consecutive reconciles that found
+	// spec.path missing, which are not retried with backoff; see
+	// countMissingPath. It is guarded by missingMu.
+	missingMu sync.Mutex
+	missing   map[string]int
+	// jitter is the largest fraction by which requeue lengthens a delay.
+	jitter float64
+	// debouncer coalesces filesystem change notifications before they are
+	// queued; see notifyChange.
+	debouncer *debouncer
+	// cooldown drops or defers keys queued again just after being
+	// reconciled; see scanCooldown.
+	cooldown *scanCooldown
+	// watcher delivers inotify events to notifyChange. It is nil when
+	// --watch-mode is poll.
+	watcher *fsWatcher
+	// feed receives the changes found by each reconcile for gRPC and
+	// WebSocket clients. It is nil when neither --grpc-addr nor
+	// --websocket-addr is set.
+	feed *changeFeed
+	// configMaps holds the ConfigMap informer factories started by
+	// watchConfigMaps, keyed by namespace, and stop the channel closing
+	// them. Both are guarded by configMapsMu and nil outside Run.
+	configMapsMu sync.Mutex
+	configMaps   map[string]informers.SharedInformerFactory
+	stop         <-chan struct{}
+
+	// synced is set once the informer cache has completed its initial sync.
+	synced atomic.Bool
+}
+
+// NewController wires a shared informer for FileMonitor objects matching
+// cfg.Selector in each of cfg.Namespaces (all namespaces when empty), at each
+// of cfg.APIVersions, to a rate limited work queue. Versions other than the
+// first that the API server does not serve are skipped. Rather than resyncing
+// the informers, each object is re-queued after its own scan interval,
+// defaulting to cfg.ResyncInterval.
+func NewController(log logr.Logger, clientset kubernetes.Interface, dynamicClient dynamic.Interface, cfg *Config) *Controller {
+	selector := cfg.Selector.String()
+	recorder, broadcaster := newEventRecorder(clientset)
+
+	c := &Controller{
+		log:           log,
+		clientset:     clientset,
+		dynamicClient: dynamicClient,
+		status:        newStatusWriter(dynamicClient, cfg.DryRun, cfg.StatusWriteMode),
+		informers:     make(map[string][]cache.SharedIndexInformer),
+		queue: workqueue.NewTypedRateLimitingQueue(
+			workqueue.DefaultTypedControllerRateLimiter[string](),
+		),
+		recorder:       recorder,
+		broadcaster:    broadcaster,
+		eventThreshold: cfg.EventAggregateThreshold,
+		scanOpts:       cfg.scanOptions(),
+		interval:       cfg.ResyncInterval,
+
+		reconcileTimeout: cfg.ReconcileTimeout,
+		workers:          cfg.Workers,
+		maxRetries:       cfg.MaxRetries,
+		missing:          make(map[string]int),
+		jitter:           cfg.JitterFactor,
+	}
+	c.status.batchSize = cfg.StatusBatchSize
+	if cfg.EmitNDJSON {
+		c.status.ndjson = newNDJSONEmitter(os.Stdout)
+		c.status.stdoutOnly = cfg.EmitTarget == emitTargetStdout
+	}
+	c.cooldown = newScanCooldown(cfg.ScanCooldown)
+	c.debouncer = newDebouncer(cfg.Debounce, c.enqueueChanged)
+	if cfg.GRPCAddr != "" || cfg.WebSocketAddr != "" {
+		c.feed = newChangeFeed()
+	}
+
+	if cfg.WatchMode == watchModeInotify {
+		watcher, err := newFSWatcher(log.WithName("watcher"), c.notifyChange)
+		if err != nil {
+			log.Error(err, "Error creating inotify watcher, falling back to polling")
+		} else {
+			c.watcher = watcher
+		}
+	}
+
+	c.versions = cfg.APIVersions[:1:1]
+	for _, version := range cfg.APIVersions[1:] {
+		// An informer for a version that is not served would never sync.
+		served, err := fileMonitorServed(clientset.Discovery(), version)
+		if err == nil && !served {
+			log.Info("Not watching FileMonitor version, it is not served", "version", version)
+			continue
+		}
+		c.versions = append(c.versions, version)
+	}
+
+	for _, namespace := range cfg.namespaces() {
+		factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, 0, namespace, func(opts *metav1.ListOptions) {
+			opts.LabelSelector = selector
+		})
+		for _, version := range c.versions {
+			informer := factory.ForResource(fileMonitorGVRFor(version)).Informer()
+			_, err := informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+				AddFunc:    c.enqueueAdd,
+				UpdateFunc: c.enqueueUpdate,
+				DeleteFunc: c.enqueueDelete,
+			})
+			if err != nil {
+				log.Error(err, "Error adding FileMonitor event handler", "namespace", namespace, "version", version)
+			}
+			if err := informer.AddIndexers(cache.Indexers{patternsFromIndex: patternsFromIndexFunc}); err != nil {
+				log.Error(err, "Error adding FileMonitor indexer", "namespace", namespace, "version", version)
+			}
+			if err := informer.SetWatchErrorHandlerWithContext(c.watchErrorHandler(namespace, version)); err != nil {
+				log.Error(err, "Error setting FileMonitor watch error handler", "namespace", namespace, "version", version)
+			}
+			c.informers[namespace] = append(c.informers[namespace], informer)
+		}
+		c.factories = append(c.factories, factory)
+	}
+
+	return c
+}
+
+// notifyChange reports a filesystem change affecting the FileMonitor with key.
+// Changes are debounced so that a burst results in a single reconcile.
+func (c *Controller) notifyChange(key string) {
+	c.debouncer.trigger(key)
+}
+
+// reconcileNow queues the FileMonitor namespace/name to be reconciled straight
+// away rather than after its scan interval, reporting false if it is not in
+// the informer cache. It fails until the cache has synced.
+func (c *Controller) reconcileNow(namespace, name string) (bool, error) {
+	if err := c.checkSynced(); err != nil {
+		return false, err
+	}
+	key := namespace + "/" + name
+	_, exists, err := c.getByKey(key)
+	if err != nil || !exists {
+		return false, err
+	}
+	c.log.Info("Reconcile requested", "namespace", namespace, "name", name)
+	c.enqueueChanged(key)
+	return true, nil
+}
+
+// enqueue adds the namespace/name key of obj to the work queue.
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.log.Error(err, "Error computing key for FileMonitor")
+		return
+	}
+	c.enqueueChanged(key)
+}
+
+// enqueueChanged adds key to the work queue because the FileMonitor, or
+// something it scans, changed, so that it is not dropped by c.cooldown.
+func (c *Controller) enqueueChanged(key string) {
+	c.cooldown.changed(key)
+	c.queue.Add(key)
+	queueDepth.Set(float64(c.queue.Len()))
+}
+
+// enqueueAdd queues a FileMonitor that was added. Objects delivered by the
+// informer's initial List are spread at random across the first resync
+// interval, so that a restart does not scan every FileMonitor at once.
+func (c *Controller) enqueueAdd(obj interface{}, isInInitialList bool) {
+	c.countFileMonitors(obj)
+	if !isInInitialList || c.jitter <= 0 {
+		c.enqueue(obj)
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.log.Error(err, "Error computing key for FileMonitor")
+		return
+	}
+	c.queue.AddAfter(key, rand.N(c.interval))
+}
+
+// enqueueDelete queues a FileMonitor that was deleted, so that reconcile
+// forgets it.
+func (c *Controller) enqueueDelete(obj interface{}) {
+	c.countFileMonitors(obj)
+	c.enqueue(obj)
+}
+
+// countFileMonitors updates filemonitor_crds_total for the namespace of obj,
+// which was just added to or deleted from the informer cache. The series is
+// dropped once the namespace has none left.
+func (c *Controller) countFileMonitors(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	informers := c.informersFor(key)
+	if len(informers) == 0 {
+		return
+	}
+	namespace, _, _ := cache.SplitMetaNamespaceKey(key)
+	// An object seen through several versions is counted once.
+	keys := make(map[string]bool)
+	for _, informer := range informers {
+		inNamespace, err := informer.GetIndexer().IndexKeys(cache.NamespaceIndex, namespace)
+		if err != nil {
+			return
+		}
+		for _, k := range inNamespace {
+			keys[k] = true
+		}
+	}
+	if len(keys) == 0 {
+		crdsTotal.DeleteLabelValues(namespace)
+		return
+	}
+	crdsTotal.WithLabelValues(namespace).Set(float64(len(keys)))
+}
+
+// requeue schedules key to be reconciled again after interval, lengthened by
+// a random fraction of up to c.jitter so that objects sharing an interval
+// drift apart.
+func (c *Controller) requeue(key string, interval time.Duration) {
+	if c.jitter > 0 {
+		interval = wait.Jitter(interval, c.jitter)
+	}
+	c.cooldown.scheduled(key, time.Now().Add(interval))
+	c.queue.AddAfter(key, interval)
+}
+
+// enqueueUpdate queues an updated FileMonitor when its spec changed, it was
+// paused or resumed, or it is being deleted. Updates that only touch status,
+// most of which are the controller's own writes, are left to the object's
+// scan interval.
+func (c *Controller) enqueueUpdate(oldObj, newObj interface{}) {
+	oldCRD, oldOK := oldObj.(*unstructured.Unstructured)
+	newCRD, newOK := newObj.(*unstructured.Unstructured)
+	if oldOK && newOK && !c.specChanged(oldCRD, newCRD) &&
+		isPaused(oldCRD) == isPaused(newCRD) && newCRD.GetDeletionTimestamp() == nil {
+		return
+	}
+	c.enqueue(newObj)
+}
+
+// specChanged reports whether the spec of a FileMonitor differs between
+// updates. This is normally told by its generation, but without the /status
+// subresource every status write bumps that too, so the specs themselves are
+// compared instead.
+func (c *Controller) specChanged(oldCRD, newCRD *unstructured.Unstructured) bool {
+	if !c.status.mainResource {
+		return oldCRD.GetGeneration() != newCRD.GetGeneration()
+	}
+	return !equality.Semantic.DeepEqual(oldCRD.Object["spec"], newCRD.Object["spec"])
+}
+
+// scanInterval returns how long to wait before rescanning fm, recording on fm
+// whether its spec.scanInterval could be used.
+func (c *Controller) scanInterval(ctx context.Context, fm *FileMonitorCRD) time.Duration {
+	interval, err := fm.Spec.scanInterval()
+	if err != nil {
+		logr.FromContextOrDiscard(ctx).Info("Ignoring invalid spec.scanInterval", "scanInterval", fm.Spec.ScanInterval, "reason", err.Error(), "default", c.interval.String())
+		setCondition(fm, conditionScanIntervalValid, metav1.ConditionFalse, "InvalidScanInterval",
+			fmt.Sprintf("%v; using the default of %s", err, c.interval))
+		return c.interval
+	}
+	setCondition(fm, conditionScanIntervalValid, metav1.ConditionTrue, "Valid", "spec.scanInterval is valid")
+	if interval == 0 {
+		return c.interval
+	}
+	return interval
+}
+
+// Run starts the informers, waits for their caches to sync and processes the work
+// queue with c.workers workers until ctx is cancelled. On cancellation no new
+// keys are started; the reconciles in flight, followed by any changes still
+// waiting out their debounce window, are given up to gracePeriod to finish
+// before their context is cancelled too.
+func (c *Controller) Run(ctx context.Context, gracePeriod time.Duration) error {
+	defer utilruntime.HandleCrash()
+	defer c.broadcaster.Shutdown()
+	c.startConfigMaps(ctx.Done())
+	defer c.stopConfigMaps()
+	var synced []cache.InformerSynced
+	for _, factory := range c.factories {
+		defer factory.Shutdown()
+		factory.Start(ctx.Done())
+	}
+	for _, informers := range c.informers {
+		for _, informer := range informers {
+			synced = append(synced, informer.HasSynced)
+		}
+	}
+
+	c.log.Info("Waiting for FileMonitor informer caches to sync", "informers", len(synced))
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		c.queue.ShutDown()
+		return fmt.Errorf("timed out waiting for FileMonitor cache to sync")
+	}
+	c.synced.Store(true)
+
+	if c.watcher != nil {
+		go c.watcher.run(ctx)
+	}
+
+	// Reconciles run under workCtx rather than ctx so that a status write
+	// already under way is not aborted the moment a signal arrives.
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.runWorker(ctx, workCtx)
+		}()
+	}
+
+	<-ctx.Done()
+	c.log.Info("Shutting down, waiting for in-flight reconciles", "gracePeriod", gracePeriod.String())
+	c.queue.ShutDown()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wg.Wait()
+		for _, key := range c.debouncer.flush() {
+			c.syncKey(workCtx, key)
+		}
+	}()
+
+	select {
+	case <-done:
+		c.log.Info("All reconciles finished, exiting")
+	case <-time.After(gracePeriod):
+		c.log.Info("Grace period expired, cancelling in-flight reconciles")
+		cancelWork()
+		<-done
+	}
+	return nil
+}
+
+// checkSynced returns an error until the informer caches have synced. It is used
+// as a readiness check.
+func (c *Controller) checkSynced() error {
+	if !c.synced.Load() {
+		return errors.New("informer cache not synced")
+	}
+	return nil
+}
+
+// runWorker processes items from the work queue until it is shut down or ctx
+// is cancelled. Reconciles are run with workCtx.
+func (c *Controller) runWorker(ctx, workCtx context.Context) {
+	for c.processNextItem(ctx, workCtx) {
+	}
+}
+
+// processNextItem reconciles a single key, requeueing it with rate limiting on
+// failure. A Retry-After delay sent by the API server is honored instead of
+// the rate limiter, and NotFound errors are not retried. After maxRetries
+// consecutive failures the key is marked Degraded instead and only retried
+// on a spec change or once its scan interval elapses. It returns false once
+// the queue has been shut down or ctx has been cancelled.
+func (c *Controller) processNextItem(ctx, workCtx context.Context) bool {
+	key, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(key)
+	queueDepth.Set(float64(c.queue.Len()))
+
+	reconcilesInFlight.Inc()
+	defer reconcilesInFlight.Dec()
+
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if wait, requeue := c.cooldown.check(key); wait > 0 {
+		c.log.V(1).Info("Key queued again during its cooldown", "key", key, "rescan", requeue, "wait", wait.String())
+		if requeue {
+			c.queue.AddAfter(key, wait)
+		}
+		return true
+	}
+
+	started := time.Now()
+	if err := c.syncKey(workCtx, key); err != nil {
+		if c.queue.NumRequeues(key) >= c.maxRetries && !apierrors.IsNotFound(err) {
+			c.giveUp(workCtx, key, err)
+			return true
+		}
+		c.requeueAfterError(key, err)
+		return true
+	}
+
+	c.cooldown.done(key, started)
+	c.queue.Forget(key)
+	return true
+}
+
+// requeueAfterError schedules key to be retried after err.
+func (c *Controller) requeueAfterError(key string, err error) {
+	switch {
+	case apierrors.IsNotFound(err):
+		c.queue.Forget(key)
+	case isTransientAPIError(err):
+		if delay, ok := retryAfter(err); ok {
+			c.log.V(1).Info("API server asked to retry later", "key", key, "retryAfter", delay.String())
+			c.queue.AddAfter(key, delay)
+			return
+		}
+		c.queue.AddRateLimited(key)
+	default:
+		c.queue.AddRateLimited(key)
+	}
+}
+
+// giveUp stops the backoff retries of key after err, its latest failure,
+// marks the FileMonitor Degraded and schedules the next attempt at its regular
+// scan interval.
+func (c *Controller) giveUp(ctx context.Context, key string, err error) {
+	attempts := c.queue.NumRequeues(key) + 1
+	c.queue.Forget(key)
+
+	namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+	log := c.log.WithValues("namespace", namespace, "name", name)
+	log.Info("Giving up on FileMonitor after repeated failures", "attempts", attempts, "error", err.Error())
+
+	interval := c.interval
+	defer func() { c.requeue(key, interval) }()
+
+	// Read the object from the API server rather than the cache, which may
+	// not hold the status the failed reconcile just wrote yet.
+	crd, gerr := c.dynamicClient.Resource(fileMonitorGVRFor(c.versions[0])).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if gerr != nil {
+		log.Error(gerr, "Error getting FileMonitor to mark it degraded")
+		return
+	}
+	fm, gerr := decodeFileMonitor(crd)
+	if gerr != nil {
+		log.Error(gerr, "Error decoding FileMonitor")
+		return
+	}
+	c.status.restoreGeneration(fm)
+	interval = c.scanInterval(ctx, fm)
+	setCondition(fm, conditionDegraded, metav1.ConditionTrue, "MaxRetriesExceeded",
+		fmt.Sprintf("%d consecutive reconciles failed, last error: %v", attempts, err))
+	if werr := c.status.write(logr.NewContext(ctx, log), fm); werr != nil {
+		log.Error(werr, "Error marking FileMonitor degraded")
+	}
+}
+
+// countMissingPath counts the reconciles of key in a row whose scan of fm
+// found spec.path missing, which syncFileMonitor does not treat as a failure
+// to retry, and marks fm Degraded once there have been c.maxRetries of them,
+// as giveUp does for other failures. Any other outcome resets the count.
+func (c *Controller) countMissingPath(ctx context.Context, key string, fm *FileMonitorCRD) error {
+	c.missingMu.Lock()
+	ready := meta.FindStatusCondition(fm.Status.Conditions, conditionReady)
+	if ready == nil || ready.Reason != "PathNotFound" {
+		delete(c.missing, key)
+		c.missingMu.Unlock()
+		return nil
+	}
+	c.missing[key]++
+	attempts := c.missing[key]
+	c.missingMu.Unlock()
+
+	if attempts < c.maxRetries {
+		return nil
+	}
+	setCondition(fm, conditionDegraded, metav1.ConditionTrue, "MaxRetriesExceeded",
+		fmt.Sprintf("spec.path was missing for %d consecutive reconciles", attempts))
+	return c.status.write(ctx, fm)
+}
+
+// forgetMissingPath drops the count of countMissingPath for key.
+func (c *Controller) forgetMissingPath(key string) {
+	c.missingMu.Lock()
+	defer c.missingMu.Unlock()
+	delete(c.missing, key)
+}
+
+// syncKey reconciles key; see sync.
+func (c *Controller) syncKey(ctx context.Context, key string) error {
+	return c.sync(ctx, key, func(ctx context.Context) error {
+		return c.reconcile(ctx, key)
+	})
+}
+
+// sync runs reconcile for key with a logger bound to its namespace and name
+// and a deadline of c.reconcileTimeout, logging and counting any error before
+// returning it.
+func (c *Controller) sync(ctx context.Context, key string, reconcile func(context.Context) error) error {
+	namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+	log := c.log.WithValues("namespace", namespace, "name", name)
+
+	ctx, cancel := context.WithTimeout(ctx, c.reconcileTimeout)
+	defer cancel()
+
+	err := reconcile(logr.NewContext(ctx, log))
+	if err != nil {
+		reconcileErrors.WithLabelValues(namespace, name).Inc()
+		recentErrors.record(namespace, name, err)
+		log.Error(err, "Error reconciling FileMonitor")
+	}
+	return err
+}
+
+// informersFor returns the informers whose caches hold the FileMonitor with
+// key, most preferred version first, or none if its namespace is not
+// watched.
+func (c *Controller) informersFor(key string) []cache.SharedIndexInformer {
+	if informers, ok := c.informers[metav1.NamespaceAll]; ok {
+		return informers
+	}
+	namespace, _, _ := cache.SplitMetaNamespaceKey(key)
+	return c.informers[namespace]
+}
+
+// getByKey returns the FileMonitor with key from the cache of the most
+// preferred version that holds it.
+func (c *Controller) getByKey(key string) (obj interface{}, exists bool, err error) {
+	for _, informer := range c.informersFor(key) {
+		obj, exists, err = informer.GetIndexer().GetByKey(key)
+		if err != nil || exists {
+			return obj, exists, err
+		}
+	}
+	return nil, false, nil
+}
+
+// reconcile scans the path of the FileMonitor identified by key, updates its
+// status and records an event for every file added or removed since the
+// previous status. Objects being deleted are cleaned up instead, and keys for
+// objects that no longer exist are ignored.
+func (c *Controller) reconcile(ctx context.Context, key string) error {
+	if len(c.informersFor(key)) == 0 {
+		logr.FromContextOrDiscard(ctx).V(1).Info("Ignoring FileMonitor outside the watched namespaces")
+		return nil
+	}
+	obj, exists, err := c.getByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		logr.FromContextOrDiscard(ctx).V(1).Info("FileMonitor no longer exists")
+		if c.watcher != nil {
+			c.watcher.unwatch(key)
+		}
+		namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+		deleteFileMonitorMetrics(namespace, name)
+		c.cooldown.forget(key)
+		c.status.forget(key)
+		c.forgetMissingPath(key)
+		return nil
+	}
+
+	crd, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unexpected object type %T", obj)
+	}
+
+	if crd.GetDeletionTimestamp() != nil {
+		return c.finalize(ctx, key, crd)
+	}
+	crd, err = c.ensureFinalizer(ctx, crd)
+	if err != nil {
+		return err
+	}
+	_, err = c.reconcileObject(ctx, key, crd)
+	return err
+}
+
+// reconcileObject does the work of reconcile for crd, which is not being
+// deleted, returning the FileMonitor decoded from it with the status it was
+// left with, or nil if it could not be decoded.
+func (c *Controller) reconcileObject(ctx context.Context, key string, crd *unstructured.Unstructured) (*FileMonitorCRD, error) {
+	fm, err := decodeFileMonitor(crd)
+	if err != nil {
+		return nil, err
+	}
+	c.status.restoreGeneration(fm)
+	recordConversion(fm)
+	recordPaused(fm)
+	if isInactive(fm) {
+		return fm, c.pause(ctx, key, fm)
+	}
+	previous := fm.Status.Files
+	previousLarge := fm.Status.LargeFiles
+
+	interval := c.scanInterval(ctx, fm)
+	pod, orphaned, err := c.pruneOrphanedStatus(ctx, crd, fm)
+	if err != nil {
+		return fm, err
+	}
+	if orphaned {
+		// Check again later in case a pod with the same name reappears.
+		c.requeue(key, interval)
+		return fm, nil
+	}
+
+	if rejected, err := rejectInvalidSpec(ctx, c.status, fm); rejected || err != nil {
+		if err != nil {
+			return fm, err
+		}
+		c.requeue(key, interval)
+		return fm, nil
+	}
+
+	if fm.Spec.source() == sourceKubeletStats && fm.Spec.PodName != "" {
+		if err := c.syncKubeletStats(ctx, fm); err != nil {
+			return fm, err
+		}
+		c.requeue(key, interval)
+		return fm, nil
+	}
+
+	if fm.Spec.PathTemplate != "" {
+		if err := renderPathTemplate(fm, pod); err != nil {
+			logr.FromContextOrDiscard(ctx).Info("Skipping scan", "reason", err.Error())
+			setCondition(fm, conditionTemplateError, metav1.ConditionTrue, "TemplateError", err.Error())
+			markScanFailed(fm, "TemplateError", err.Error())
+			if werr := c.status.write(ctx, fm); werr != nil {
+				return fm, werr
+			}
+			c.requeue(key, interval)
+			return fm, nil
+		}
+		setCondition(fm, conditionTemplateError, metav1.ConditionFalse, "Rendered", "spec.pathTemplate rendered to "+fm.Spec.Path)
+	}
+
+	if fm.Spec.PVCName != "" {
+		path, err := resolvePVCPath(ctx, c.clientset, fm.Namespace, fm.Spec.PVCName, fm.Spec.PVCSubPath)
+		var verr *volumeError
+		if errors.As(err, &verr) {
+			// The claim may yet be bound, or rebound to another volume.
+			logr.FromContextOrDiscard(ctx).Info("Skipping scan", "reason", verr.Error())
+			if verr.unsupported {
+				setCondition(fm, conditionUnsupportedVolume, metav1.ConditionTrue, verr.reason, verr.msg)
+			}
+			markScanFailed(fm, verr.reason, verr.msg)
+			if werr := c.status.write(ctx, fm); werr != nil {
+				return fm, werr
+			}
+			c.requeue(key, interval)
+			return fm, nil
+		}
+		if err != nil {
+			return fm, err
+		}
+		setCondition(fm, conditionUnsupportedVolume, metav1.ConditionFalse, "Resolved", "spec.pvcName resolved to "+path)
+		// Like a rendered spec.pathTemplate, only changed in memory.
+		fm.Spec.Path = path
+	}
+
+	if fm.Spec.Path != "" {
+		if rejected, err := rejectInvalidPath(ctx, c.status, fm, c.scanOpts.ForbiddenPaths); rejected || err != nil {
+			if err != nil {
+				return fm, err
+			}
+			// A literal spec.path stays rejected until the spec is edited,
+			// which queues the object again, but one rendered from
+			// spec.pathTemplate or resolved from spec.pvcName may change
+			// along with the pod or claim.
+			if fm.Spec.PathTemplate != "" || fm.Spec.PVCName != "" {
+				c.requeue(key, interval)
+			}
+			return fm, nil
+		}
+	}
+	if err := c.loadPatterns(ctx, fm); err != nil {
+		return fm, err
+	}
+
+	opts := c.scanOpts
+	// A rendered spec.pathTemplate names a path on the node, such as the
+	// kubelet's directory for the pod, so it is resolved under --host-root
+	// like any other rather than inside the pod's container.
+	if fm.Spec.PodName != "" && fm.Spec.PathTemplate == "" {
+		containerID, reason, err := podContainerID(pod, fm.Spec.ContainerName)
+		if err != nil {
+			// Nothing can be scanned until the container starts, which pod
+			// events do not signal here, so check again on the scan interval.
+			logr.FromContextOrDiscard(ctx).Info("Skipping scan", "reason", err.Error())
+			setCondition(fm, conditionContainerRunning, metav1.ConditionFalse, reason, err.Error())
+			markScanFailed(fm, reason, err.Error())
+			if werr := c.status.write(ctx, fm); werr != nil {
+				return fm, werr
+			}
+			c.requeue(key, interval)
+			return fm, nil
+		}
+		setCondition(fm, conditionContainerRunning, metav1.ConditionTrue, "ContainerRunning", "container "+containerID+" is running")
+
+		rootfs, err := resolvePodRootfs(string(fm.Status.PodUID), containerID)
+		if err != nil {
+			markScanFailed(fm, "PodRootfsNotFound", err.Error())
+			if werr := c.status.write(ctx, fm); werr != nil {
+				return fm, werr
+			}
+			return fm, fmt.Errorf("resolving root filesystem of pod %s: %w", fm.Spec.PodName, err)
+		}
+		opts.Root = rootfs
+	}
+
+	files, err := syncFileMonitor(ctx, c.status, fm, opts)
+	if apierrors.IsNotFound(err) {
+		return fm, nil
+	}
+	if err != nil {
+		return fm, err
+	}
+
+	if c.watcher != nil && fm.Spec.Path != "" {
+		c.watcher.watch(key, watchDirs(fm.paths(), opts, files), fm.Spec.recursive())
+	}
+	if err := c.countMissingPath(ctx, key, fm); err != nil {
+		return fm, err
+	}
+
+	added, removed := diffFiles(previous, fm.Status.Files)
+	emitFileEvents(c.recorder, crd, c.eventThreshold, added, removed)
+	changes := scanChanges(fm, previous)
+	emitModifiedEvents(c.recorder, crd, c.eventThreshold, changes)
+	c.publishChanges(fm, changes)
+	emitLargeFileEvents(c.recorder, crd, c.eventThreshold, fm.Spec.LargeFileThreshold, previousLarge, fm.Status.LargeFiles)
+
+	c.requeue(key, interval)
+	return fm, nil
+}
+
+// pruneOrphanedStatus checks that the pod named by spec.podName still exists
+// and returns it. If it does not, status.files is cleared, an event explains
+// why and true is returned so the caller skips the scan. If the pod was
+// recreated under the same name, the files recorded for the old pod are
+// dropped before scanning.
+func (c *Controller) pruneOrphanedStatus(ctx context.Context, crd *unstructured.Unstructured, fm *FileMonitorCRD) (*corev1.Pod, bool, error) {
+	if fm.Spec.PodName == "" {
+		return nil, false, nil
+	}
+
+	pod, err := c.clientset.CoreV1().Pods(fm.Namespace).Get(ctx, fm.Spec.PodName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, false, fmt.Errorf("getting pod %s: %w", fm.Spec.PodName, err)
+	}
+
+	switch {
+	case apierrors.IsNotFound(err):
+		if fm.Status.PodUID == "" && len(fm.Status.Files) == 0 {
+			return nil, true, nil
+		}
+		c.recorder.Eventf(crd, corev1.EventTypeNormal, reasonPodDeleted,
+			"Pod %s no longer exists, cleared %d files from status", fm.Spec.PodName, len(fm.Status.Files))
+		fm.Status.Files = nil
+		fm.Status.PodUID = ""
+		return nil, true, c.status.write(ctx, fm)
+
+	case fm.Status.PodUID != "" && fm.Status.PodUID != pod.UID:
+		c.recorder.Eventf(crd, corev1.EventTypeNormal, reasonPodDeleted,
+			"Pod %s was recreated (uid %s), discarding files recorded for uid %s", fm.Spec.PodName, pod.UID, fm.Status.PodUID)
+		fm.Status.Files = nil
+	}
+
+	fm.Status.PodUID = pod.UID
+	return pod, false, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// newTestController returns a Controller for the FileMonitor default/m with
+// spec, held by the fake client also returned, that status is written with
+// JSON Patch through.
+func newTestController(t *testing.T, spec map[string]interface{}) (*Controller, *dynamicfake.FakeDynamicClient) {
+	t.Helper()
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": fileMonitorGVR.GroupVersion().String(),
+		"kind":       fileMonitorKind,
+		"metadata": map[string]interface{}{
+			"name": "m", "namespace": "default", "uid": "1", "generation": int64(1),
+		},
+		"spec": spec,
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{fileMonitorGVR: "FileMonitorList"}, u)
+	c := &Controller{
+		dynamicClient: client,
+		status:        newStatusWriter(client, false, statusWriteJSONPatch),
+		queue:         workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+		recorder:      record.NewFakeRecorder(100),
+		cooldown:      newScanCooldown(0),
+		interval:      time.Hour,
+		maxRetries:    defaultMaxRetries,
+		missing:       make(map[string]int),
+	}
+	t.Cleanup(c.queue.ShutDown)
+	return c, client
+}
+
+// reconcileTestObject reads default/m back from client and reconciles it as
+// reconcile would.
+func reconcileTestObject(t *testing.T, c *Controller, client *dynamicfake.FakeDynamicClient) (*FileMonitorCRD, error) {
+	t.Helper()
+	obj, err := client.Resource(fileMonitorGVR).Namespace("default").Get(context.Background(), "m", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.reconcileObject(context.Background(), "default/m", obj)
+}
+
+func TestMissingPathMarkedDegraded(t *testing.T) {
+	c, client := newTestController(t, map[string]interface{}{"path": filepath.Join(t.TempDir(), "missing")})
+	c.maxRetries = 3
+
+	degraded := func() *metav1.Condition {
+		obj, err := client.Resource(fileMonitorGVR).Namespace("default").Get(context.Background(), "m", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fm, err := decodeFileMonitor(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return meta.FindStatusCondition(fm.Status.Conditions, conditionDegraded)
+	}
+	for i := 1; i <= c.maxRetries; i++ {
+		if _, err := reconcileTestObject(t, c, client); err != nil {
+			t.Fatalf("reconcile %d: %v", i, err)
+		}
+		cond := degraded()
+		if got, want := cond != nil && cond.Status == metav1.ConditionTrue, i == c.maxRetries; got != want {
+			t.Fatalf("after reconcile %d Degraded = %v, want it True only after %d", i, cond, c.maxRetries)
+		}
+	}
+	if cond := degraded(); cond.Reason != "MaxRetriesExceeded" {
+		t.Errorf("Degraded reason = %q, want MaxRetriesExceeded", cond.Reason)
+	}
+}
+
+// TestRejectedDerivedPathRequeued checks that a forbidden spec.path resolved
+// from spec.pvcName is checked again later, while a literal one waits for the
+// spec to be edited.
+func TestRejectedDerivedPathRequeued(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        map[string]interface{}
+		wantRequeue bool
+	}{
+		{name: "literal path", spec: map[string]interface{}{"path": "/forbidden/data"}},
+		{name: "claim", spec: map[string]interface{}{"pvcName": "data"}, wantRequeue: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, client := newTestController(t, tt.spec)
+			c.clientset = kubefake.NewClientset(
+				&corev1.PersistentVolumeClaim{
+					ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "default"},
+					Spec:       corev1.PersistentVolumeClaimSpec{VolumeName: "pv"},
+					Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimBound},
+				},
+				&corev1.PersistentVolume{
+					ObjectMeta: metav1.ObjectMeta{Name: "pv"},
+					Spec: corev1.PersistentVolumeSpec{PersistentVolumeSource: corev1.PersistentVolumeSource{
+						HostPath: &corev1.HostPathVolumeSource{Path: "/forbidden/data"},
+					}},
+				},
+			)
+			c.scanOpts.ForbiddenPaths = []string{"/forbidden"}
+			// The cooldown records when the key was last scheduled again.
+			c.cooldown = newScanCooldown(time.Hour)
+
+			fm, err := reconcileTestObject(t, c, client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ready := meta.FindStatusCondition(fm.Status.Conditions, conditionReady); ready == nil || ready.Reason != "PathForbidden" {
+				t.Fatalf("Ready = %v, want reason PathForbidden", ready)
+			}
+			st := c.cooldown.keys["default/m"]
+			if requeued := st != nil && !st.due.IsZero(); requeued != tt.wantRequeue {
+				t.Errorf("requeued = %t, want %t", requeued, tt.wantRequeue)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// FileMonitor API versions the controller can read, for --api-versions.
+const (
+	fileMonitorV1      = "v1"
+	fileMonitorV1beta1 = "v1beta1"
+)
+
+// v1beta1SpecRenames maps the v1beta1 names of the spec fields that were
+// renamed to their v1 names, which FileMonitorSpec uses. Every other field,
+// and all of status, is the same in both versions.
+var v1beta1SpecRenames = map[string]string{
+	"target":          "path",
+	"interval":        "scanInterval",
+	"excludePatterns": "exclude",
+	"maxEntries":      "maxFiles",
+	"followLinks":     "followSymlinks",
+}
+
+// specFields holds the JSON names of the fields of FileMonitorSpec.
+var specFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(FileMonitorSpec{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+	}
+	return fields
+}()
+
+// parseAPIVersions splits the comma-separated --api-versions list, dropping
+// duplicates and keeping the order, which is the order of preference.
+func parseAPIVersions(list string) ([]string, error) {
+	var versions []string
+	seen := make(map[string]bool)
+	for _, v := range strings.Split(list, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		if v != fileMonitorV1 && v != fileMonitorV1beta1 {
+			return nil, fmt.Errorf("invalid version %q in --api-versions: must be %s or %s", v, fileMonitorV1, fileMonitorV1beta1)
+		}
+		seen[v] = true
+		versions = append(versions, v)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("--api-versions must list at least one version")
+	}
+	return versions, nil
+}
+
+// fileMonitorGVRFor returns fileMonitorGVR at version.
+func fileMonitorGVRFor(version string) schema.GroupVersionResource {
+	gvr := fileMonitorGVR
+	gvr.Version = version
+	return gvr
+}
+
+// gvr returns the resource fm was read as, so that its status is written
+// back through the same version.
+func (fm *FileMonitorCRD) gvr() schema.GroupVersionResource {
+	gv, err := schema.ParseGroupVersion(fm.APIVersion)
+	if err != nil || gv.Group != fileMonitorGVR.Group || gv.Version == "" {
+		return fileMonitorGVR
+	}
+	return fileMonitorGVRFor(gv.Version)
+}
+
+// convertSpec rewrites the spec of u, in either version, into the field
+// names of FileMonitorSpec, returning a warning for each field that could
+// not be carried over. The names are told apart by themselves rather than by
+// apiVersion, as without a conversion webhook an object written as one
+// version is served unchanged as the other; the CRD schemas keep both names
+// for that reason. Should a field be set under both its names, the one of
+// u's own version wins. Fields known to neither version, which the v1beta1
+// schema lets through, are dropped. u is not modified.
+func convertSpec(u *unstructured.Unstructured) (*unstructured.Unstructured, []string) {
+	spec, ok := u.Object["spec"].(map[string]interface{})
+	if !ok {
+		return u, nil
+	}
+	v1beta1 := strings.HasSuffix(u.GetAPIVersion(), "/"+fileMonitorV1beta1)
+
+	var warnings []string
+	converted := make(map[string]interface{}, len(spec))
+	for _, name := range sortedKeys(spec) {
+		value := spec[name]
+		if v1Name, ok := v1beta1SpecRenames[name]; ok {
+			if _, both := spec[v1Name]; both {
+				used := v1Name
+				if v1beta1 {
+					used = name
+				}
+				warnings = append(warnings, fmt.Sprintf("spec.%s and spec.%s are the same field in %s and %s; using spec.%s",
+					name, v1Name, fileMonitorV1beta1, fileMonitorV1, used))
+				if !v1beta1 {
+					continue
+				}
+			}
+			converted[v1Name] = value
+			continue
+		}
+		if !specFields[name] {
+			warnings = append(warnings, fmt.Sprintf("spec.%s is not a field of %s or %s and is ignored", name, fileMonitorV1, fileMonitorV1beta1))
+			continue
+		}
+		if _, renamed := converted[name]; renamed && v1beta1 {
+			// Already set from its v1beta1 name, which wins here.
+			continue
+		}
+		converted[name] = value
+	}
+	if len(warnings) == 0 && !hasRenamed(spec) {
+		return u, nil
+	}
+	sort.Strings(warnings)
+
+	out := u.DeepCopy()
+	out.Object["spec"] = converted
+	return out, warnings
+}
+
+// hasRenamed reports whether spec uses any v1beta1 field name.
+func hasRenamed(spec map[string]interface{}) bool {
+	for name := range spec {
+		if _, ok := v1beta1SpecRenames[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// recordConversion sets the ConversionWarning condition of fm from the
+// warnings of its conversion. An object that never needed converting is left
+// without the condition.
+func recordConversion(fm *FileMonitorCRD) {
+	switch {
+	case len(fm.conversionWarnings) > 0:
+		setCondition(fm, conditionConversionWarning, metav1.ConditionTrue, "FieldsIgnored", strings.Join(fm.conversionWarnings, "; "))
+	case hasRenamed(fm.rawSpec) || meta.FindStatusCondition(fm.Status.Conditions, conditionConversionWarning) != nil:
+		setCondition(fm, conditionConversionWarning, metav1.ConditionFalse, "Converted", "every spec field was carried over")
+	}
+}
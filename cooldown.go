@@ -0,0 +1,114 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultScanCooldown is the default for --scan-cooldown.
+const defaultScanCooldown = 500 * time.Millisecond
+
+// scanCooldown stops a key from being reconciled again right after a
+// successful reconcile of it, as happens when a resync and a filesystem event
+// queue it in quick succession. A key that comes up within window of its last
+// reconcile finishing is only reconciled again once the window ends, and then
+// only if something changed since that reconcile started, or its periodic
+// rescan comes due within the window; otherwise it is dropped as already
+// covered. It is safe for concurrent use.
+type scanCooldown struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	keys map[string]*cooldownState
+}
+
+// cooldownState is what scanCooldown knows about one key.
+type cooldownState struct {
+	// started and finished bound the last successful reconcile.
+	started, finished time.Time
+	// changed is when a change to the key was last signalled.
+	changed time.Time
+	// due is when the key was last scheduled to be reconciled again.
+	due time.Time
+}
+
+func newScanCooldown(window time.Duration) *scanCooldown {
+	return &scanCooldown{window: window, keys: make(map[string]*cooldownState)}
+}
+
+// changed records that key was queued because something about it changed,
+// rather than by its periodic rescan or a retry.
+func (c *scanCooldown) changed(key string) {
+	if c.window <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.keys[key]
+	if !ok {
+		st = &cooldownState{}
+		c.keys[key] = st
+	}
+	st.changed = time.Now()
+}
+
+// scheduled records that key was queued to be reconciled again at due, by its
+// periodic rescan or a retry. Should due fall within the window, that
+// reconcile is the only one queued and must not be dropped, as nothing else
+// would bring the key up again.
+func (c *scanCooldown) scheduled(key string, due time.Time) {
+	if c.window <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.keys[key]
+	if !ok {
+		st = &cooldownState{}
+		c.keys[key] = st
+	}
+	st.due = due
+}
+
+// check returns how long key must wait before being reconciled, or zero if it
+// may be now. When the wait is not zero, requeue tells whether it is to be
+// reconciled once the wait is over.
+func (c *scanCooldown) check(key string) (wait time.Duration, requeue bool) {
+	if c.window <= 0 {
+		return 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.keys[key]
+	if !ok || st.finished.IsZero() {
+		return 0, false
+	}
+	wait = time.Until(st.finished.Add(c.window))
+	if wait <= 0 {
+		return 0, false
+	}
+	rescan := st.due.After(st.started) && !st.due.After(st.finished.Add(c.window))
+	return wait, rescan || st.changed.After(st.started)
+}
+
+// done records a successful reconcile of key that started at started.
+func (c *scanCooldown) done(key string, started time.Time) {
+	if c.window <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.keys[key]
+	if !ok {
+		st = &cooldownState{}
+		c.keys[key] = st
+	}
+	st.started, st.finished = started, time.Now()
+}
+
+// forget drops what is known about key, once its object is gone.
+func (c *scanCooldown) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.keys, key)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScanCooldownCheck(t *testing.T) {
+	const key = "default/m"
+	tests := []struct {
+		name string
+		// setup runs after a reconcile of key that finished just now.
+		setup       func(c *scanCooldown, started time.Time)
+		wantRequeue bool
+	}{
+		{
+			name:        "duplicate with nothing new",
+			setup:       func(c *scanCooldown, started time.Time) {},
+			wantRequeue: false,
+		},
+		{
+			name:        "changed during the reconcile",
+			setup:       func(c *scanCooldown, started time.Time) { c.changed(key) },
+			wantRequeue: true,
+		},
+		{
+			name: "scan interval shorter than the cooldown",
+			setup: func(c *scanCooldown, started time.Time) {
+				c.scheduled(key, time.Now().Add(time.Minute))
+			},
+			wantRequeue: true,
+		},
+		{
+			name: "scan interval longer than the cooldown",
+			setup: func(c *scanCooldown, started time.Time) {
+				c.scheduled(key, time.Now().Add(2*time.Hour))
+			},
+			wantRequeue: false,
+		},
+		{
+			name: "rescan scheduled before the reconcile",
+			setup: func(c *scanCooldown, started time.Time) {
+				c.scheduled(key, started.Add(-time.Second))
+			},
+			wantRequeue: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newScanCooldown(time.Hour)
+			started := time.Now().Add(-time.Millisecond)
+			c.done(key, started)
+			tt.setup(c, started)
+
+			wait, requeue := c.check(key)
+			if wait <= 0 {
+				t.Fatalf("check() wait = %s, want the rest of the window", wait)
+			}
+			if requeue != tt.wantRequeue {
+				t.Errorf("check() requeue = %t, want %t", requeue, tt.wantRequeue)
+			}
+		})
+	}
+}
+
+// TestScanCooldownKeepsPeriodicRescan checks that a key rescanned more often
+// than the cooldown allows keeps being rescanned, as the periodic requeue is
+// all that brings it up again.
+func TestScanCooldownKeepsPeriodicRescan(t *testing.T) {
+	const key = "default/m"
+	interval, window := 10*time.Millisecond, 50*time.Millisecond
+	c := newScanCooldown(window)
+
+	started := time.Now()
+	c.scheduled(key, started.Add(interval))
+	c.done(key, started)
+
+	time.Sleep(interval)
+	wait, requeue := c.check(key)
+	if wait <= 0 || !requeue {
+		t.Fatalf("check() = %s, %t; want the rescan deferred to the end of the window", wait, requeue)
+	}
+
+	time.Sleep(wait)
+	if wait, _ := c.check(key); wait > 0 {
+		t.Errorf("check() after the window = %s, want 0", wait)
+	}
+}
+
+func TestScanCooldownDisabled(t *testing.T) {
+	c := newScanCooldown(0)
+	c.done("default/m", time.Now())
+	if wait, requeue := c.check("default/m"); wait != 0 || requeue {
+		t.Errorf("check() = %s, %t; want 0, false", wait, requeue)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// crdManifest is the CustomResourceDefinition of FileMonitor, including the
+// OpenAPI schema the API server validates specs against.
+//
+//go:embed manifests/filemonitor-crd.yaml
+var crdManifest []byte
+
+// crdEstablishTimeout bounds how long installCRD waits for the API server to
+// start serving FileMonitors.
+const crdEstablishTimeout = 30 * time.Second
+
+// crdGVR identifies CustomResourceDefinition objects.
+var crdGVR = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// installCRD creates or updates the FileMonitor CustomResourceDefinition from
+// crdManifest and waits for it to be established. It uses server-side apply,
+// so running it again with an unchanged manifest is a no-op.
+func installCRD(ctx context.Context, dynamicClient dynamic.Interface) error {
+	data, err := yaml.YAMLToJSON(crdManifest)
+	if err != nil {
+		return fmt.Errorf("decoding embedded CRD manifest: %w", err)
+	}
+
+	name := fileMonitorGVR.Resource + "." + fileMonitorGVR.Group
+	force := true
+	_, err = dynamicClient.Resource(crdGVR).Patch(ctx, name, types.ApplyPatchType, data,
+		metav1.PatchOptions{FieldManager: fieldManager, Force: &force})
+	if err != nil {
+		return fmt.Errorf("applying CRD %s: %w", name, err)
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, time.Second, crdEstablishTimeout, true, func(ctx context.Context) (bool, error) {
+		crd, err := dynamicClient.Resource(crdGVR).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return crdEstablished(crd), nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for CRD %s to be established: %w", name, err)
+	}
+	return nil
+}
+
+// crdEstablished reports whether crd has the Established condition set.
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if ok && cond["type"] == "Established" && cond["status"] == string(metav1.ConditionTrue) {
+			return true
+		}
+	}
+	return false
+}
+
+// crdCheckBackoff paces the checks made by waitForCRD while FileMonitors are
+// not being served.
+var crdCheckBackoff = wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: math.MaxInt32, Cap: time.Minute}
+
+// fileMonitorServed asks discovery whether the API server serves
+// FileMonitors at version.
+func fileMonitorServed(client discovery.DiscoveryInterface, version string) (bool, error) {
+	return groupVersionServes(client, version, fileMonitorGVR.Resource)
+}
+
+// statusSubresourceServed asks discovery whether the FileMonitor CRD enables
+// the /status subresource at version.
+func statusSubresourceServed(client discovery.DiscoveryInterface, version string) (bool, error) {
+	return groupVersionServes(client, version, fileMonitorGVR.Resource+"/status")
+}
+
+// groupVersionServes reports whether discovery lists resource, which may
+// name a subresource as "resource/subresource", in the FileMonitor group at
+// version.
+func groupVersionServes(client discovery.DiscoveryInterface, version, resource string) (bool, error) {
+	resources, err := client.ServerResourcesForGroupVersion(fileMonitorGVRFor(version).GroupVersion().String())
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == resource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// waitForCRD blocks until the API server serves FileMonitors at version,
+// checking with backoff so that a missing CRD is neither fatal nor logged on
+// every attempt. When install is set, each attempt first tries to install the
+// CRD. present is set once it is served.
+func waitForCRD(ctx context.Context, log logr.Logger, client discovery.DiscoveryInterface, dynamicClient dynamic.Interface, version string, install bool, present *atomic.Bool) error {
+	backoff := crdCheckBackoff
+	for attempt := 0; ; attempt++ {
+		if install {
+			if err := installCRD(ctx, dynamicClient); err != nil {
+				log.Error(err, "Error installing FileMonitor CRD")
+			} else {
+				log.Info("Installed FileMonitor CRD")
+				install = false
+			}
+		}
+
+		served, err := fileMonitorServed(client, version)
+		switch {
+		case served:
+			present.Store(true)
+			if attempt > 0 {
+				log.Info("FileMonitor CRD is now installed")
+			}
+			return nil
+		case err != nil:
+			log.V(1).Info("Error checking for the FileMonitor CRD", "error", err.Error())
+		case attempt == 0:
+			log.Info("FileMonitor CRD is not installed, waiting for it", "resource", fileMonitorGVRFor(version).String())
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff.Step()):
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultDebounce is the default for --debounce.
+const defaultDebounce = 2 * time.Second
+
+// debouncer coalesces bursts of change notifications per key. fire is called
+// for a key once no trigger for it has arrived for the debounce window.
+type debouncer struct {
+	window time.Duration
+	fire   func(key string)
+
+	mu      sync.Mutex
+	timers  map[string]*time.Timer
+	stopped bool
+}
+
+func newDebouncer(window time.Duration, fire func(key string)) *debouncer {
+	return &debouncer{
+		window: window,
+		fire:   fire,
+		timers: make(map[string]*time.Timer),
+	}
+}
+
+// trigger records a change for key, restarting its quiet window. With a zero
+// window fire is called immediately.
+func (d *debouncer) trigger(key string) {
+	if d.window <= 0 {
+		d.fire(key)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+	if t, ok := d.timers[key]; ok {
+		t.Reset(d.window)
+		return
+	}
+	d.timers[key] = time.AfterFunc(d.window, func() {
+		d.mu.Lock()
+		delete(d.timers, key)
+		d.mu.Unlock()
+		d.fire(key)
+	})
+}
+
+// flush stops the debouncer and returns the keys whose window had not yet
+// elapsed, without firing them. Later triggers are ignored.
+func (d *debouncer) flush() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stopped = true
+	keys := make([]string, 0, len(d.timers))
+	for key, t := range d.timers {
+		if t.Stop() {
+			keys = append(keys, key)
+		}
+		delete(d.timers, key)
+	}
+	return keys
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// merkleRoot returns the hex-encoded SHA-256 Merkle root of files. Each leaf
+// hashes the path, size and modification time of one entry, with entries in
+// path order; an odd node out at any level is carried up unchanged. An empty
+// list has the hash of no input as its root.
+func merkleRoot(files []FileInfo) string {
+	sorted := make([]FileInfo, len(files))
+	copy(sorted, files)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+
+	level := make([][]byte, 0, len(sorted))
+	for _, f := range sorted {
+		h := sha256.New()
+		h.Write([]byte(f.Path))
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.FormatInt(f.Size, 10)))
+		h.Write([]byte{0})
+		h.Write([]byte(f.ModTime.UTC().Format(time.RFC3339Nano)))
+		level = append(level, h.Sum(nil))
+	}
+	if len(level) == 0 {
+		sum := sha256.Sum256(nil)
+		return hex.EncodeToString(sum[:])
+	}
+
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h := sha256.New()
+			h.Write(level[i])
+			h.Write(level[i+1])
+			next = append(next, h.Sum(nil))
+		}
+		level = next
+	}
+	return hex.EncodeToString(level[0])
+}
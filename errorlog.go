@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// recentErrorsPath is where the metrics server serves recentErrors.
+const recentErrorsPath = "/debug/errors"
+
+// recentErrorsSize is how many reconcile errors recentErrors keeps.
+const recentErrorsSize = 100
+
+// recentErrors holds the latest reconcile errors of every worker, for
+// operators without access to the logs.
+var recentErrors = newErrorRing(recentErrorsSize)
+
+// reconcileError is one entry of recentErrors.
+type reconcileError struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Message   string    `json:"message"`
+}
+
+// errorRing is a fixed-size buffer of the most recent reconcile errors, the
+// oldest being overwritten first. It is safe for concurrent use.
+type errorRing struct {
+	mu      sync.Mutex
+	entries []reconcileError
+	// next is the index the next entry is written at.
+	next int
+	full bool
+}
+
+func newErrorRing(size int) *errorRing {
+	return &errorRing{entries: make([]reconcileError, size)}
+}
+
+// record adds err, returned by the reconcile of namespace/name, to the ring.
+func (r *errorRing) record(namespace, name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = reconcileError{Time: time.Now().UTC(), Namespace: namespace, Name: name, Message: err.Error()}
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the errors in the ring, newest first.
+func (r *errorRing) list() []reconcileError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.next
+	if r.full {
+		n = len(r.entries)
+	}
+	list := make([]reconcileError, 0, n)
+	for i := 1; i <= n; i++ {
+		list = append(list, r.entries[(r.next-i+len(r.entries))%len(r.entries)])
+	}
+	return list
+}
+
+// ServeHTTP writes the errors in the ring as a JSON array, newest first.
+func (r *errorRing) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(r.list())
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// eventSource is the component name attached to events emitted by the
+// controller.
+const eventSource = "filemonitor-controller"
+
+// Event reasons recorded on FileMonitor objects.
+const (
+	reasonFileAdded   = "FileAdded"
+	reasonFileRemoved = "FileRemoved"
+	// reasonFileModified events say how the size or modification time of
+	// the file changed.
+	reasonFileModified = "FileModified"
+	reasonPodDeleted   = "TargetPodDeleted"
+	reasonCleanedUp    = "CleanedUp"
+	// reasonLargeFileDetected is a warning, as it usually calls for someone
+	// to look at the file.
+	reasonLargeFileDetected = "LargeFileDetected"
+)
+
+// defaultEventAggregateThreshold is the default for --event-aggregate-threshold.
+const defaultEventAggregateThreshold = 20
+
+// eventSamplePaths is how many paths an aggregated event names.
+const eventSamplePaths = 3
+
+// newEventRecorder returns a recorder that writes events through clientset,
+// along with the broadcaster that must be shut down when the controller stops.
+func newEventRecorder(clientset kubernetes.Interface) (record.EventRecorder, record.EventBroadcaster) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventSource})
+	return recorder, broadcaster
+}
+
+// fileKey identifies a file across scans by path and inode, so a path that is
+// replaced by a different file is reported as removed and added.
+func fileKey(f FileInfo) string {
+	return f.Path + "\x00" + strconv.FormatUint(f.Inode, 10)
+}
+
+// diffFiles returns the files present in current but not previous (added) and
+// those present in previous but not current (removed).
+func diffFiles(previous, current []FileInfo) (added, removed []FileInfo) {
+	seen := make(map[string]struct{}, len(previous))
+	for _, f := range previous {
+		seen[fileKey(f)] = struct{}{}
+	}
+
+	now := make(map[string]struct{}, len(current))
+	for _, f := range current {
+		key := fileKey(f)
+		now[key] = struct{}{}
+		if _, ok := seen[key]; !ok {
+			added = append(added, f)
+		}
+	}
+
+	for _, f := range previous {
+		if _, ok := now[fileKey(f)]; !ok {
+			removed = append(removed, f)
+		}
+	}
+	return added, removed
+}
+
+// emitFileEvents records one event on crd for every added and removed file,
+// or a single one for each kind when there are more than threshold of them.
+func emitFileEvents(recorder record.EventRecorder, crd *unstructured.Unstructured, threshold int, added, removed []FileInfo) {
+	emitPerFile(recorder, crd, corev1.EventTypeNormal, reasonFileAdded, threshold, filePaths(added), "added", func(i int) string {
+		return fmt.Sprintf("File %s was added", added[i].Path)
+	})
+	emitPerFile(recorder, crd, corev1.EventTypeNormal, reasonFileRemoved, threshold, filePaths(removed), "removed", func(i int) string {
+		return fmt.Sprintf("File %s was removed", removed[i].Path)
+	})
+}
+
+// emitModifiedEvents records one event on crd for every modified change, or a
+// single one when there are more than threshold of them. Additions and
+// removals are left to emitFileEvents.
+func emitModifiedEvents(recorder record.EventRecorder, crd *unstructured.Unstructured, threshold int, changes []FileChange) {
+	var modified []FileChange
+	var paths []string
+	for _, change := range changes {
+		if change.ChangeType == changeModified {
+			modified = append(modified, change)
+			paths = append(paths, change.Path)
+		}
+	}
+	emitPerFile(recorder, crd, corev1.EventTypeNormal, reasonFileModified, threshold, paths, "modified", func(i int) string {
+		return modified[i].message()
+	})
+}
+
+// emitPerFile records an event of reason on crd for each of paths, described
+// by message. When there are more than threshold of them, and threshold is
+// not zero, a single event counting them is recorded instead, so that a scan
+// finding thousands of changes does not flood the API server, which would
+// throttle and drop them.
+func emitPerFile(recorder record.EventRecorder, crd *unstructured.Unstructured, eventType, reason string, threshold int, paths []string, verb string, message func(i int) string) {
+	if threshold == 0 || len(paths) <= threshold {
+		for i := range paths {
+			recorder.Event(crd, eventType, reason, message(i))
+		}
+		return
+	}
+	recorder.Eventf(crd, eventType, reason, "%d files were %s: %s", len(paths), verb, samplePaths(paths))
+}
+
+// samplePaths lists the first eventSamplePaths of paths, sorted, and how many
+// more there are.
+func samplePaths(paths []string) string {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+	if len(sorted) <= eventSamplePaths {
+		return strings.Join(sorted, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(sorted[:eventSamplePaths], ", "), len(sorted)-eventSamplePaths)
+}
+
+// filePaths returns the paths of files.
+func filePaths(files []FileInfo) []string {
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+	}
+	return paths
+}
+
+// largeFiles returns the non-directory entries of files bigger than
+// threshold, in path order, or nil when threshold is zero.
+func largeFiles(files []FileInfo, threshold int64) []LargeFile {
+	if threshold <= 0 {
+		return nil
+	}
+	var large []LargeFile
+	for _, f := range files {
+		if !f.IsDir && f.Size > threshold {
+			large = append(large, LargeFile{Path: f.Path, Size: f.Size})
+		}
+	}
+	sort.Slice(large, func(i, j int) bool { return large[i].Path < large[j].Path })
+	return large
+}
+
+// emitLargeFileEvents records a warning for every file in current that was
+// not already listed in previous, so that a file is only reported again after
+// it has dropped back under the threshold. More than aggregate of them are
+// reported in a single warning, as by emitPerFile.
+func emitLargeFileEvents(recorder record.EventRecorder, crd *unstructured.Unstructured, aggregate int, threshold int64, previous, current []LargeFile) {
+	seen := make(map[string]struct{}, len(previous))
+	for _, f := range previous {
+		seen[f.Path] = struct{}{}
+	}
+	var detected []LargeFile
+	var paths []string
+	for _, f := range current {
+		if _, ok := seen[f.Path]; !ok {
+			detected = append(detected, f)
+			paths = append(paths, f.Path)
+		}
+	}
+	emitPerFile(recorder, crd, corev1.EventTypeWarning, reasonLargeFileDetected, aggregate, paths,
+		fmt.Sprintf("found over the threshold of %d bytes", threshold), func(i int) string {
+			return fmt.Sprintf("File %s is %d bytes, over the threshold of %d", detected[i].Path, detected[i].Size, threshold)
+		})
+}
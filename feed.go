@@ -0,0 +1,108 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// changeBufferSize is how many changes a subscriber may fall behind by before
+// further changes are dropped for it.
+const changeBufferSize = 1024
+
+// feedEvent is a change found in the status of the FileMonitor
+// Namespace/Name.
+type feedEvent struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	FileChange
+}
+
+// changeFeed fans the file changes detected by reconciles out to every open
+// gRPC and WebSocket stream. It is safe for concurrent use.
+type changeFeed struct {
+	mu     sync.Mutex
+	subs   map[*changeSubscriber]struct{}
+	closed bool
+}
+
+// changeSubscriber is one stream and the FileMonitors it asked for.
+type changeSubscriber struct {
+	namespace, name string
+	ch              chan feedEvent
+	// dropped counts the changes the stream missed by falling behind.
+	dropped prometheus.Counter
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{subs: make(map[*changeSubscriber]struct{})}
+}
+
+// subscribe registers a subscriber for the changes of FileMonitors matching
+// namespace and name, either of which may be empty to match any. Changes it
+// misses are counted by dropped. Its channel is closed when the feed is.
+func (f *changeFeed) subscribe(namespace, name string, dropped prometheus.Counter) *changeSubscriber {
+	sub := &changeSubscriber{namespace: namespace, name: name, ch: make(chan feedEvent, changeBufferSize), dropped: dropped}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		close(sub.ch)
+		return sub
+	}
+	f.subs[sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe stops delivering changes to sub.
+func (f *changeFeed) unsubscribe(sub *changeSubscriber) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subs[sub]; ok {
+		delete(f.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// publish delivers changes to the FileMonitor namespace/name to every
+// matching subscriber. A subscriber whose buffer is full misses them rather
+// than holding up the reconcile.
+func (f *changeFeed) publish(namespace, name string, changes []FileChange) {
+	if f == nil || len(changes) == 0 {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for sub := range f.subs {
+		if (sub.namespace != "" && sub.namespace != namespace) || (sub.name != "" && sub.name != name) {
+			continue
+		}
+		for _, change := range changes {
+			select {
+			case sub.ch <- feedEvent{Namespace: namespace, Name: name, FileChange: change}:
+			default:
+				sub.dropped.Inc()
+			}
+		}
+	}
+}
+
+// close ends every subscription, so that open streams return. It may be
+// called more than once.
+func (f *changeFeed) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for sub := range f.subs {
+		delete(f.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// publishChanges sends changes, found in the status of fm by its latest
+// scan, to the streams subscribed to it.
+func (c *Controller) publishChanges(fm *FileMonitorCRD, changes []FileChange) {
+	if c.feed == nil {
+		return
+	}
+	c.feed.publish(fm.Namespace, fm.Name, changes)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// cleanupFinalizer holds a deleted FileMonitor until the controller has torn
+// down what it set up for it.
+const cleanupFinalizer = "sentinalfs.io/cleanup"
+
+// ensureFinalizer adds cleanupFinalizer to crd if it is missing, returning
+// the object as it is afterwards: crd itself, or the patched object, so that
+// the status written next is checked against the new resourceVersion rather
+// than conflicting with the finalizer's own write. It must not be called for
+// objects that are already being deleted.
+func (c *Controller) ensureFinalizer(ctx context.Context, crd *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	finalizers := crd.GetFinalizers()
+	if slices.Contains(finalizers, cleanupFinalizer) {
+		return crd, nil
+	}
+	return c.patchFinalizers(ctx, crd, append(finalizers, cleanupFinalizer))
+}
+
+// finalize tears down the watches of the FileMonitor with key, which is being
+// deleted, records a final event and removes cleanupFinalizer so the deletion
+// can complete.
+func (c *Controller) finalize(ctx context.Context, key string, crd *unstructured.Unstructured) error {
+	finalizers := crd.GetFinalizers()
+	if !slices.Contains(finalizers, cleanupFinalizer) {
+		return nil
+	}
+
+	if c.watcher != nil {
+		c.watcher.unwatch(key)
+	}
+	c.recorder.Event(crd, corev1.EventTypeNormal, reasonCleanedUp, "FileMonitor is being deleted, stopped monitoring")
+
+	_, err := c.patchFinalizers(ctx, crd, slices.DeleteFunc(slices.Clone(finalizers), func(f string) bool {
+		return f == cleanupFinalizer
+	}))
+	return err
+}
+
+// patchFinalizers replaces the finalizers of crd and returns the patched
+// object, or crd when nothing is written: in dry-run mode and under
+// --emit-target=stdout, as for status. The patch is conditional on the
+// resourceVersion that was read, so a concurrent change fails with a conflict
+// and the key is retried instead of being overwritten.
+func (c *Controller) patchFinalizers(ctx context.Context, crd *unstructured.Unstructured, finalizers []string) (*unstructured.Unstructured, error) {
+	if c.status.dryRun || c.status.stdoutOnly {
+		return crd, nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": crd.GetResourceVersion(),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding finalizer patch: %w", err)
+	}
+
+	resp, err := c.dynamicClient.Resource(fileMonitorGVRFor(crd.GroupVersionKind().Version)).Namespace(crd.GetNamespace()).
+		Patch(ctx, crd.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("updating finalizers: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/SentinalFS/file-monitor-kube-controller/api/filemonitorpb"
+)
+
+// gRPC keepalive settings. The server pings idle connections so that clients
+// that went away without closing their stream are noticed and torn down.
+const (
+	grpcKeepaliveTime    = 30 * time.Second
+	grpcKeepaliveTimeout = 10 * time.Second
+	grpcKeepaliveMinTime = 10 * time.Second
+)
+
+// changeEvent converts ev to its wire form.
+func changeEvent(ev feedEvent) *filemonitorpb.FileChangeEvent {
+	changeType := filemonitorpb.ChangeType_CHANGE_TYPE_UNSPECIFIED
+	switch ev.ChangeType {
+	case changeAdded:
+		changeType = filemonitorpb.ChangeType_CHANGE_TYPE_ADDED
+	case changeModified:
+		changeType = filemonitorpb.ChangeType_CHANGE_TYPE_MODIFIED
+	case changeRemoved:
+		changeType = filemonitorpb.ChangeType_CHANGE_TYPE_REMOVED
+	}
+	pb := &filemonitorpb.FileChangeEvent{
+		Namespace:  ev.Namespace,
+		Name:       ev.Name,
+		Path:       ev.Path,
+		ChangeType: changeType,
+		Time:       timestamppb.New(ev.Time.Time),
+		OldSize:    ev.OldSize,
+		NewSize:    ev.NewSize,
+	}
+	if ev.OldModTime != nil && ev.NewModTime != nil {
+		pb.OldModTime = timestamppb.New(ev.OldModTime.Time)
+		pb.NewModTime = timestamppb.New(ev.NewModTime.Time)
+	}
+	return pb
+}
+
+// fileChangesServer implements the FileChanges gRPC service on top of a
+// changeFeed.
+type fileChangesServer struct {
+	filemonitorpb.UnimplementedFileChangesServer
+	log  logr.Logger
+	feed *changeFeed
+}
+
+// WatchFileChanges streams changes until the client goes away or the feed is
+// closed on shutdown.
+func (s *fileChangesServer) WatchFileChanges(req *filemonitorpb.WatchFileChangesRequest, stream grpc.ServerStreamingServer[filemonitorpb.FileChangeEvent]) error {
+	sub := s.feed.subscribe(req.GetNamespace(), req.GetName(), grpcChangesDropped)
+	defer s.feed.unsubscribe(sub)
+
+	s.log.V(1).Info("WatchFileChanges stream opened", "namespace", req.GetNamespace(), "name", req.GetName())
+	defer s.log.V(1).Info("WatchFileChanges stream closed", "namespace", req.GetNamespace(), "name", req.GetName())
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case ev, ok := <-sub.ch:
+			if !ok {
+				return status.Error(codes.Unavailable, "controller is shutting down")
+			}
+			if err := stream.Send(changeEvent(ev)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// serveGRPC serves the FileChanges service on addr until ctx is cancelled,
+// then closes feed so open streams end before the server stops.
+func serveGRPC(ctx context.Context, log logr.Logger, addr string, feed *changeFeed) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Error(err, "gRPC server failed")
+		return
+	}
+
+	srv := grpc.NewServer(
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: grpcKeepaliveTime, Timeout: grpcKeepaliveTimeout}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: grpcKeepaliveMinTime, PermitWithoutStream: true}),
+	)
+	filemonitorpb.RegisterFileChangesServer(srv, &fileChangesServer{log: log, feed: feed})
+
+	go func() {
+		<-ctx.Done()
+		feed.close()
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			srv.Stop()
+		}
+	}()
+
+	log.Info("Serving gRPC file change stream", "addr", addr)
+	if err := srv.Serve(lis); err != nil {
+		log.Error(err, "gRPC server failed")
+	}
+}
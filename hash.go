@@ -0,0 +1,147 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// hashAlgoSHA256 is the FileInfo.HashAlgo value for SHA-256 digests.
+const hashAlgoSHA256 = "sha256"
+
+// defaultMaxHashSize is the default for --max-hash-size.
+const defaultMaxHashSize = 64 << 20
+
+// defaultHashCacheSize is the default for --hash-cache-size.
+const defaultHashCacheSize = 10000
+
+// maxHashAttempts bounds how often a file that keeps changing while it is
+// hashed is read, so that one written to constantly is not read forever.
+const maxHashAttempts = 2
+
+// hashFile streams the contents of path through SHA-256, at the pace allowed
+// by throttle, and returns the hex-encoded digest.
+func hashFile(ctx context.Context, path string, throttle *ioThrottle) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, throttle.reader(ctx, f)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFileSettled hashes path like hashFile, then stats it again, at the pace
+// allowed by throttle: if its size or modification time no longer match info,
+// it was written to while being read, as an active log is, and the digest may
+// mix old and new contents. It is then read again, up to maxHashAttempts
+// times in all, and if it still changed the last digest is returned with
+// stale set. The returned info describes the file as of the last read.
+func hashFileSettled(ctx context.Context, path string, info os.FileInfo, throttle *ioThrottle) (sum string, settled os.FileInfo, stale bool, err error) {
+	for attempt := 1; ; attempt++ {
+		if sum, err = hashFile(ctx, path, throttle); err != nil {
+			return "", nil, false, err
+		}
+		if err := throttle.wait(ctx); err != nil {
+			return "", nil, false, err
+		}
+		after, err := os.Stat(path)
+		if err != nil {
+			return "", nil, false, err
+		}
+		if after.Size() == info.Size() && after.ModTime().Equal(info.ModTime()) {
+			return sum, info, false, nil
+		}
+		if attempt == maxHashAttempts {
+			staleHashes.Inc()
+			return sum, after, true, nil
+		}
+		info = after
+	}
+}
+
+// hashCache remembers the digest computed for each file, identified by device
+// and inode, along with the size and modification time it had then, so that
+// files unchanged since the previous scan are not read again. It holds at most
+// size entries, evicting the least recently used, and is safe for concurrent
+// use by every worker.
+type hashCache struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // of *hashCacheEntry, most recently used first
+	entries map[fileID]*list.Element
+}
+
+type hashCacheEntry struct {
+	id      fileID
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// newHashCache returns a cache of at most size entries, or nil, which caches
+// nothing, when size is zero.
+func newHashCache(size int) *hashCache {
+	if size <= 0 {
+		return nil
+	}
+	return &hashCache{size: size, order: list.New(), entries: make(map[fileID]*list.Element)}
+}
+
+// hash returns the digest of the file at path, described by info and st,
+// reading it only if the cache holds no digest for the same size and
+// modification time. settled describes the file as of the read the digest
+// came from, as returned by hashFileSettled; it is info itself unless the file
+// changed and was read again. stale is set if the file kept changing; such
+// digests are not cached.
+func (c *hashCache) hash(ctx context.Context, path string, info os.FileInfo, st sysStat, throttle *ioThrottle) (sum string, settled os.FileInfo, stale bool, err error) {
+	if c == nil || st.Inode == 0 {
+		return hashFileSettled(ctx, path, info, throttle)
+	}
+	id := fileID{device: st.Device, inode: st.Inode}
+
+	c.mu.Lock()
+	if el, ok := c.entries[id]; ok {
+		e := el.Value.(*hashCacheEntry)
+		if e.size == info.Size() && e.modTime.Equal(info.ModTime()) {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			hashCacheHits.Inc()
+			return e.sum, info, false, nil
+		}
+		// The file changed, or the inode was reused for another one.
+		c.order.Remove(el)
+		delete(c.entries, id)
+	}
+	c.mu.Unlock()
+	hashCacheMisses.Inc()
+
+	sum, settled, stale, err = hashFileSettled(ctx, path, info, throttle)
+	if err != nil || stale {
+		return sum, settled, stale, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[id]; ok {
+		// Hashed concurrently by another worker.
+		c.order.Remove(el)
+	}
+	c.entries[id] = c.order.PushFront(&hashCacheEntry{id: id, size: settled.Size(), modTime: settled.ModTime(), sum: sum})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*hashCacheEntry).id)
+	}
+	return sum, settled, false, nil
+}
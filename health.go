@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// defaultHealthAddr is the default listen address of the health server.
+const defaultHealthAddr = ":8081"
+
+// adminReconcilePath is where the health server takes requests to reconcile a
+// FileMonitor now; see handleReconcile.
+const adminReconcilePath = "/reconcile"
+
+// healthServer serves liveness and readiness probes. /healthz succeeds once
+// markAlive has been called; /readyz succeeds once every registered readiness
+// check passes. With pprof set it also serves the net/http/pprof profiles
+// under /debug/pprof/, and with admin set the endpoints of
+// --enable-admin-endpoints.
+type healthServer struct {
+	alive atomic.Bool
+	pprof bool
+	admin bool
+
+	mu     sync.RWMutex
+	checks []readyCheck
+	// reconcile queues the FileMonitor namespace/name for an immediate
+	// reconcile, reporting whether it exists. It is nil until the controller
+	// is created.
+	reconcile func(namespace, name string) (bool, error)
+}
+
+// readyCheck is a named readiness condition. check returns nil when ready, or
+// an error describing why not.
+type readyCheck struct {
+	name  string
+	check func() error
+}
+
+// newHealthServer returns a health server, serving profiles if pprof is set
+// and the admin endpoints if admin is; see --enable-pprof and
+// --enable-admin-endpoints.
+func newHealthServer(pprof, admin bool) *healthServer {
+	return &healthServer{pprof: pprof, admin: admin}
+}
+
+// markAlive makes /healthz report success.
+func (h *healthServer) markAlive() {
+	h.alive.Store(true)
+}
+
+// addReadyCheck registers a condition that must pass for /readyz to succeed.
+func (h *healthServer) addReadyCheck(name string, check func() error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, readyCheck{name: name, check: check})
+}
+
+// setReconcile registers the function behind adminReconcilePath.
+func (h *healthServer) setReconcile(reconcile func(namespace, name string) (bool, error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.reconcile = reconcile
+}
+
+func (h *healthServer) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	if !h.alive.Load() {
+		http.Error(w, "clients not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (h *healthServer) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	h.mu.RLock()
+	checks := h.checks
+	h.mu.RUnlock()
+
+	if len(checks) == 0 {
+		http.Error(w, "controller not started", http.StatusServiceUnavailable)
+		return
+	}
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			http.Error(w, fmt.Sprintf("%s: %v", c.name, err), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReconcile serves POST /reconcile?namespace=X&name=Y, queueing that
+// FileMonitor to be reconciled straight away rather than after its scan
+// interval. It answers 202 once queued and 404 if there is no such
+// FileMonitor among those watched.
+func (h *healthServer) handleReconcile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	namespace, name := r.URL.Query().Get("namespace"), r.URL.Query().Get("name")
+	if namespace == "" || name == "" {
+		http.Error(w, "the namespace and name query parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	h.mu.RLock()
+	reconcile := h.reconcile
+	h.mu.RUnlock()
+	if reconcile == nil {
+		http.Error(w, "controller not started", http.StatusServiceUnavailable)
+		return
+	}
+	found, err := reconcile(namespace, name)
+	switch {
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case !found:
+		http.Error(w, fmt.Sprintf("FileMonitor %s/%s not found", namespace, name), http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "FileMonitor %s/%s queued\n", namespace, name)
+	}
+}
+
+// serve serves /healthz and /readyz, and the profiles and admin endpoints if
+// enabled, on addr until ctx is cancelled.
+func (h *healthServer) serve(ctx context.Context, log logr.Logger, addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.handleHealthz)
+	mux.HandleFunc("/readyz", h.handleReadyz)
+	if h.pprof {
+		handlePprof(mux)
+		log.Info("Serving pprof profiles", "addr", addr, "path", "/debug/pprof/")
+	}
+	if h.admin {
+		mux.HandleFunc(adminReconcilePath, h.handleReconcile)
+		log.Info("Serving admin endpoints", "addr", addr, "paths", []string{adminReconcilePath})
+	}
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Error(err, "Error shutting down health server")
+		}
+	}()
+
+	log.Info("Serving health probes", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error(err, "Health server failed")
+	}
+}
+
+// handlePprof mounts the net/http/pprof handlers on mux. For slow scans the
+// most telling are usually:
+//
+//   - /debug/pprof/profile?seconds=30, a CPU profile, for time spent
+//     hashing, matching contents or walking;
+//   - /debug/pprof/goroutine?debug=2, to see where every worker is blocked,
+//     for instance in a stat on a hung network filesystem or waiting on
+//     --scan-iops-limit;
+//   - /debug/pprof/heap and /debug/pprof/allocs, for the memory held and
+//     churned by large status.files listings.
+func handlePprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// defaultFullScanInterval is how often an incremental FileMonitor is scanned
+// in full when spec.fullScanInterval is unset.
+const defaultFullScanInterval = time.Hour
+
+// modTimeSlack widens the window of an incremental scan to cover file
+// timestamps, which the kernel takes from a coarser clock than time.Now.
+const modTimeSlack = time.Second
+
+// incrementalSince decides whether the next scan of fm may be incremental,
+// returning the time files must have been modified after to be looked at
+// again. The scan has to be full when spec.incremental is off, when the
+// previous status is not a complete listing to build on, such as one without
+// files because of spec.compact or spec.dirsOnly, when the spec
+// changed since, and once spec.fullScanInterval has passed since the last
+// full scan, which is the only kind that notices deletions.
+func incrementalSince(fm *FileMonitorCRD, now time.Time) (time.Time, bool) {
+	status := fm.Status
+	switch {
+	case !fm.Spec.Incremental, fm.Spec.Compact, fm.Spec.DirsOnly,
+		status.LastScanTime == nil, status.LastFullScanTime == nil,
+		status.ObservedGeneration != fm.Generation,
+		status.Truncated, len(status.Files) == 0:
+		return time.Time{}, false
+	}
+	interval, err := fm.Spec.fullScanInterval()
+	if err != nil || interval == 0 {
+		interval = defaultFullScanInterval
+	}
+	if now.Sub(status.LastFullScanTime.Time) >= interval {
+		return time.Time{}, false
+	}
+	// lastScanTime is when the previous scan finished; a file it had
+	// already passed may have been modified while it was still running.
+	started := status.LastScanTime.Add(-time.Duration(status.LastScanDuration) * time.Millisecond)
+	return started.Add(-modTimeSlack), true
+}
+
+// mergeIncremental combines the entries found by an incremental scan with
+// those of previous it skipped as unchanged. Entries the scan found replace
+// their previous versions; the rest are kept unless spec.newerThan now
+// excludes them, the deleted ones included until the next full scan. The
+// result is in the order a full scan would produce, and its totals cover
+// every entry. matches are the content matches recorded with previous, which
+// carry over to the entries kept.
+func mergeIncremental(previous []FileInfo, matches []ContentMatch, scanned scanResult, opts scanOptions) scanResult {
+	lines := contentLines(matches)
+	found := make(map[string]struct{}, len(scanned.Files))
+	for _, f := range scanned.Files {
+		found[f.Path] = struct{}{}
+	}
+
+	files := append([]FileInfo(nil), scanned.Files...)
+	for _, f := range previous {
+		if _, ok := found[f.Path]; ok {
+			continue
+		}
+		if !f.IsDir && f.ModTime.Before(opts.ModifiedAfter) {
+			continue
+		}
+		f.contentLine = lines[f.Path]
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return walkOrderLess(files[i].Path, files[j].Path) })
+
+	merged := scanResult{Files: make([]FileInfo, 0, len(files)), root: scanned.root}
+	for _, f := range files {
+		merged.add(f)
+	}
+	return merged
+}
+
+// walkOrderLess orders paths as a lexical directory walk visits them: a
+// directory's entries come straight after it, before any sibling whose name
+// merely starts with the directory's name.
+func walkOrderLess(a, b string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] == b[i] {
+			continue
+		}
+		if a[i] == '/' {
+			return true
+		}
+		if b[i] == '/' {
+			return false
+		}
+		return a[i] < b[i]
+	}
+	return len(a) < len(b)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// patchOp is one RFC 6902 JSON Patch operation. Value is the JSON encoding of
+// the operand, so that a null operand is still sent.
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// diffJSON returns the operations that turn old into new, two values decoded
+// from JSON, at the JSON Pointer path. Objects are compared key by key and
+// arrays element by element after their common head and tail, so that adding
+// or removing one file in the middle of status.files patches just that entry.
+// Anything else that differs is replaced whole.
+func diffJSON(path string, old, new interface{}) ([]patchOp, error) {
+	if reflect.DeepEqual(old, new) {
+		return nil, nil
+	}
+	switch o := old.(type) {
+	case map[string]interface{}:
+		if n, ok := new.(map[string]interface{}); ok {
+			return diffObjects(path, o, n)
+		}
+	case []interface{}:
+		if n, ok := new.([]interface{}); ok {
+			return diffArrays(path, o, n)
+		}
+	}
+	op, err := newPatchOp("replace", path, new)
+	if err != nil {
+		return nil, err
+	}
+	return []patchOp{op}, nil
+}
+
+func diffObjects(path string, old, new map[string]interface{}) ([]patchOp, error) {
+	var ops []patchOp
+	for _, key := range sortedKeys(old) {
+		if _, ok := new[key]; !ok {
+			ops = append(ops, patchOp{Op: "remove", Path: path + "/" + escapePointer(key)})
+		}
+	}
+	for _, key := range sortedKeys(new) {
+		at := path + "/" + escapePointer(key)
+		oldValue, ok := old[key]
+		if !ok {
+			op, err := newPatchOp("add", at, new[key])
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, op)
+			continue
+		}
+		changed, err := diffJSON(at, oldValue, new[key])
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, changed...)
+	}
+	return ops, nil
+}
+
+func diffArrays(path string, old, new []interface{}) ([]patchOp, error) {
+	head := 0
+	for head < len(old) && head < len(new) && reflect.DeepEqual(old[head], new[head]) {
+		head++
+	}
+	tail := 0
+	for tail < len(old)-head && tail < len(new)-head && reflect.DeepEqual(old[len(old)-1-tail], new[len(new)-1-tail]) {
+		tail++
+	}
+	old, new = old[head:len(old)-tail], new[head:len(new)-tail]
+
+	var ops []patchOp
+	common := min(len(old), len(new))
+	for i := 0; i < common; i++ {
+		changed, err := diffJSON(path+"/"+strconv.Itoa(head+i), old[i], new[i])
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, changed...)
+	}
+	for i := common; i < len(new); i++ {
+		op, err := newPatchOp("add", path+"/"+strconv.Itoa(head+i), new[i])
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	// Each removal shifts the rest down, so the surplus is removed from the
+	// same index.
+	for i := common; i < len(old); i++ {
+		ops = append(ops, patchOp{Op: "remove", Path: path + "/" + strconv.Itoa(head+common)})
+	}
+	return ops, nil
+}
+
+func newPatchOp(op, path string, value interface{}) (patchOp, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return patchOp{}, err
+	}
+	return patchOp{Op: op, Path: path, Value: data}, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapePointer escapes a key for use as a JSON Pointer reference token.
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
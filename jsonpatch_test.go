@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// statusFiles returns a status listing files in the form diffJSON is given
+// it by statusWriter.patch.
+func statusFiles(t *testing.T, files ...FileInfo) map[string]interface{} {
+	t.Helper()
+	status, err := statusJSON(FileMonitorStatus{Files: files})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestDiffJSONFiles(t *testing.T) {
+	a := FileInfo{Name: "a", Path: "/data/a", Size: 1, Hash: "aa"}
+	b := FileInfo{Name: "b", Path: "/data/b", Size: 2, Hash: "bb"}
+	c := FileInfo{Name: "c", Path: "/data/c", Size: 3, Hash: "cc"}
+	grown := b
+	grown.Size, grown.Hash = 20, "b2"
+	labelled := a
+	labelled.Xattrs = map[string]string{"user.a~b": "1"}
+	relabelled := a
+	relabelled.Xattrs = map[string]string{"user.a~b": "2", "user.c/d": "3"}
+
+	tests := []struct {
+		name     string
+		old, new []FileInfo
+		want     []string
+	}{
+		{
+			name: "append",
+			old:  []FileInfo{a, b},
+			new:  []FileInfo{a, b, c},
+			want: []string{`add /status/files/2 {"device":0,"gid":0,"hash":"cc","inode":0,"isDir":false,"modTime":"0001-01-01T00:00:00Z","name":"c","path":"/data/c","size":3,"uid":0}`},
+		},
+		{
+			name: "remove from the middle",
+			old:  []FileInfo{a, b, c},
+			new:  []FileInfo{a, c},
+			want: []string{"remove /status/files/1"},
+		},
+		{
+			name: "remove several from the end",
+			old:  []FileInfo{a, b, c},
+			new:  []FileInfo{a},
+			want: []string{"remove /status/files/1", "remove /status/files/1"},
+		},
+		{
+			name: "replace size and hash",
+			old:  []FileInfo{a, b, c},
+			new:  []FileInfo{a, grown, c},
+			want: []string{`replace /status/files/1/hash "b2"`, "replace /status/files/1/size 20"},
+		},
+		{
+			name: "escaped keys",
+			old:  []FileInfo{labelled},
+			new:  []FileInfo{relabelled},
+			want: []string{`replace /status/files/0/xattrs/user.a~0b "2"`, `add /status/files/0/xattrs/user.c~1d "3"`},
+		},
+		{
+			name: "unchanged",
+			old:  []FileInfo{a, b},
+			new:  []FileInfo{a, b},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := diffJSON("/status", statusFiles(t, tt.old...), statusFiles(t, tt.new...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, op := range ops {
+				s := op.Op + " " + op.Path
+				if op.Value != nil {
+					s += " " + string(op.Value)
+				}
+				got = append(got, s)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("diffJSON() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("op %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEscapePointer(t *testing.T) {
+	for key, want := range map[string]string{
+		"plain": "plain",
+		"a/b":   "a~1b",
+		"a~b":   "a~0b",
+		"~/":    "~0~1",
+		"~1":    "~01",
+	} {
+		if got := escapePointer(key); got != want {
+			t.Errorf("escapePointer(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestStatusPatchFallsBackToUpdate(t *testing.T) {
+	tests := []struct {
+		name            string
+		stored          map[string]interface{}
+		resourceVersion string
+	}{
+		{name: "no stored status", resourceVersion: "1"},
+		{name: "no resourceVersion", stored: map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": fileMonitorGVR.GroupVersion().String(),
+				"kind":       fileMonitorKind,
+				"metadata":   map[string]interface{}{"name": "m", "namespace": "default"},
+				"spec":       map[string]interface{}{"path": "/data"},
+			}}
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{fileMonitorGVR: "FileMonitorList"}, u)
+			fm, err := decodeFileMonitor(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fm.stored = tt.stored
+			fm.ResourceVersion = tt.resourceVersion
+			fm.Status.Files = []FileInfo{{Name: "a", Path: "/data/a"}}
+
+			w := newStatusWriter(client, false, statusWriteJSONPatch)
+			if err := w.patch(context.Background(), fm); err != nil {
+				t.Fatal(err)
+			}
+			actions := client.Actions()
+			if len(actions) != 1 {
+				t.Fatalf("got %d actions, want 1: %v", len(actions), actions)
+			}
+			if verb, sub := actions[0].GetVerb(), actions[0].GetSubresource(); verb != "update" || sub != "status" {
+				t.Errorf("status written with %s of %q, want update of status", verb, sub)
+			}
+			if fm.stored == nil {
+				t.Error("stored status not recorded after the update")
+			}
+		})
+	}
+}
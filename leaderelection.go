@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// defaultLeaseName is the default for --leader-elect-lease-name.
+const defaultLeaseName = "file-monitor-kube-controller"
+
+// serviceAccountNamespaceFile holds the namespace of the pod the controller
+// runs in, when running in-cluster.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// Leader election timings, matching the defaults of the Kubernetes
+// controller managers.
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// errLostLeadership is returned by runWithLeaderElection when the lease is
+// lost before ctx is cancelled.
+var errLostLeadership = errors.New("lost leader election lease")
+
+// leaseNamespace returns namespace, or the namespace of the controller's own
+// pod when namespace is empty, falling back to "default".
+func leaseNamespace(namespace string) string {
+	if namespace != "" {
+		return namespace
+	}
+	if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+		if ns := strings.TrimSpace(string(data)); ns != "" {
+			return ns
+		}
+	}
+	return metav1.NamespaceDefault
+}
+
+// runWithLeaderElection blocks campaigning for the Lease named by cfg and runs
+// onLeading once this replica holds it. onLeading's context is cancelled when
+// the lease is lost or ctx is done; runWithLeaderElection waits for it to
+// return. It returns errLostLeadership if the lease was lost while ctx is
+// still active, since the controller cannot be restarted in-process.
+func runWithLeaderElection(ctx context.Context, log logr.Logger, clientset kubernetes.Interface, cfg *Config, onLeading func(context.Context) error) error {
+	identity, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("determining leader election identity: %w", err)
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      cfg.LeaderElectLeaseName,
+			Namespace: leaseNamespace(cfg.LeaderElectNamespace),
+		},
+		Client:     clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	leaderCh := make(chan context.Context, 1)
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Name:            cfg.LeaderElectLeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				log.Info("Acquired leader election lease", "lease", lock.Describe(), "identity", identity)
+				leaderCh <- leaderCtx
+			},
+			OnStoppedLeading: func() {
+				log.Info("Stopped leading", "lease", lock.Describe(), "identity", identity)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					log.Info("Another replica is leading", "leader", leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("creating leader elector: %w", err)
+	}
+
+	log.Info("Waiting to acquire leader election lease", "lease", lock.Describe(), "identity", identity)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		elector.Run(ctx)
+	}()
+
+	var leaderCtx context.Context
+	select {
+	case leaderCtx = <-leaderCh:
+	case <-done:
+		select {
+		case leaderCtx = <-leaderCh:
+		default:
+		}
+	}
+
+	if leaderCtx != nil {
+		err := onLeading(leaderCtx)
+		<-done
+		if err != nil {
+			return err
+		}
+	}
+
+	if ctx.Err() == nil {
+		return errLostLeadership
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// defaultLogLevel is the default for --log-level.
+const defaultLogLevel = "info"
+
+// newLogger returns a JSON zap-backed logger at level, which is one of the zap
+// level names (debug, info, warn, error). logr's V(1) messages are emitted at
+// debug.
+func newLogger(level string) (logr.Logger, error) {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return logr.Discard(), fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.Level = zap.NewAtomicLevelAt(lvl)
+	cfg.Sampling = nil
+
+	zl, err := cfg.Build()
+	if err != nil {
+		return logr.Discard(), err
+	}
+	return zapr.NewLogger(zl), nil
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+// initKubernetesClients builds the typed and dynamic clients from kubeconfig,
+// or from the default loading rules when kubeconfig is empty.
+func initKubernetesClients(kubeconfig string) (kubernetes.Interface, dynamic.Interface, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules, &clientcmd.ConfigOverrides{},
+	).ClientConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return clientset, dynamicClient, nil
+}
+
+// defaultListPageSize is the default for --list-page-size.
+const defaultListPageSize = 500
+
+// queryCRDs lists the FileMonitor objects at version in namespace matching
+// selector in pages of at most pageSize objects, calling fn with each page
+// before fetching the next.
+func queryCRDs(ctx context.Context, dynamicClient dynamic.Interface, version, namespace string, selector labels.Selector, pageSize int64, fn func(*unstructured.UnstructuredList) error) error {
+	return listPages(ctx, dynamicClient.Resource(fileMonitorGVRFor(version)).Namespace(namespace), selector, pageSize, fn)
+}
+
+// queryAllCRDs lists the FileMonitor objects at version across all namespaces
+// matching selector in pages of at most pageSize objects, calling fn with
+// each page before fetching the next.
+func queryAllCRDs(ctx context.Context, dynamicClient dynamic.Interface, version string, selector labels.Selector, pageSize int64, fn func(*unstructured.UnstructuredList) error) error {
+	return listPages(ctx, dynamicClient.Resource(fileMonitorGVRFor(version)), selector, pageSize, fn)
+}
+
+// listPages follows the continue token of a chunked List, so that only one
+// page is held in memory at a time.
+func listPages(ctx context.Context, client dynamic.ResourceInterface, selector labels.Selector, pageSize int64, fn func(*unstructured.UnstructuredList) error) error {
+	opts := metav1.ListOptions{Limit: pageSize, LabelSelector: selector.String()}
+	for {
+		page, err := client.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if page.GetContinue() == "" {
+			return nil
+		}
+		opts.Continue = page.GetContinue()
+	}
+}
+
+// listFileMonitors lists the FileMonitor objects at version matching selector
+// in each of namespaces in turn, a page at a time. A namespace of
+// metav1.NamespaceAll lists every namespace.
+func listFileMonitors(ctx context.Context, dynamicClient dynamic.Interface, version string, namespaces []string, selector labels.Selector, pageSize int64, fn func(*unstructured.UnstructuredList) error) error {
+	for _, namespace := range namespaces {
+		var err error
+		if namespace == metav1.NamespaceAll {
+			err = queryAllCRDs(ctx, dynamicClient, version, selector, pageSize, fn)
+		} else {
+			err = queryCRDs(ctx, dynamicClient, version, namespace, selector, pageSize, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncFileMonitor scans the spec.path of a single FileMonitor, writes the
+// result to its status and returns every file the scan found, which may be
+// more than status.files holds. Should the scan fail, only its conditions are
+// updated and the files listed before are returned, along with the error
+// unless spec.path merely does not exist yet. fm is modified in place.
+func syncFileMonitor(ctx context.Context, status *statusWriter, fm *FileMonitorCRD, opts scanOptions) ([]FileInfo, error) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	if fm.Spec.Path == "" {
+		log.Info("FileMonitor has no spec.path, skipping")
+		return fm.Status.Files, nil
+	}
+	if rejected, err := rejectInvalidPath(ctx, status, fm, opts.ForbiddenPaths); rejected || err != nil {
+		return fm.Status.Files, err
+	}
+
+	opts = opts.withSpec(fm.Spec)
+	if age, err := fm.Spec.newerThan(); err != nil {
+		log.Info("Ignoring invalid spec.newerThan", "newerThan", fm.Spec.NewerThan, "reason", err.Error())
+		setCondition(fm, conditionNewerThanValid, metav1.ConditionFalse, "InvalidNewerThan", err.Error()+"; no age limit applied")
+	} else {
+		setCondition(fm, conditionNewerThanValid, metav1.ConditionTrue, "Valid", "spec.newerThan is valid")
+		if age > 0 {
+			opts.ModifiedAfter = time.Now().Add(-age)
+		}
+	}
+	if cutoff, err := fm.Spec.since(time.Now()); err != nil {
+		log.Info("Ignoring invalid spec.since", "since", fm.Spec.Since, "reason", err.Error())
+		setCondition(fm, conditionSinceValid, metav1.ConditionFalse, "InvalidSince", err.Error()+"; no cutoff applied for it")
+	} else {
+		setCondition(fm, conditionSinceValid, metav1.ConditionTrue, "Valid", "spec.since is valid")
+		if cutoff.After(opts.ModifiedAfter) {
+			opts.ModifiedAfter = cutoff
+		}
+	}
+	if re, err := fm.Spec.contentMatch(); err != nil {
+		log.Info("Ignoring invalid spec.contentMatch", "contentMatch", fm.Spec.ContentMatch, "reason", err.Error())
+		setCondition(fm, conditionContentMatchValid, metav1.ConditionFalse, "InvalidContentMatch", err.Error()+"; file contents are not matched")
+	} else {
+		setCondition(fm, conditionContentMatchValid, metav1.ConditionTrue, "Valid", "spec.contentMatch is valid")
+		opts.ContentMatch = re
+	}
+
+	start := time.Now()
+	since, incremental := incrementalSince(fm, start)
+	if incremental {
+		opts.UnchangedSince = since
+	}
+	result, err := scanPaths(ctx, fm.paths(), opts)
+	elapsed := time.Since(start)
+	scanDuration.WithLabelValues(fm.Namespace, fm.Name).Observe(elapsed.Seconds())
+	filesScanned.WithLabelValues(fm.Namespace, fm.Name).Add(float64(len(result.Files)))
+	corrupt := result.corrupt
+	if err == nil && incremental {
+		result = mergeIncremental(fm.Status.Files, fm.Status.ContentMatches, result, opts)
+	}
+	files := result.Files
+	now := metav1.Now()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fm.Status.Files, recordScanTimeout(ctx, status, fm, elapsed)
+	}
+	if errors.Is(err, context.Canceled) {
+		// Shutting down; leave the status as it was.
+		return fm.Status.Files, err
+	}
+	if err != nil {
+		reason := "ScanFailed"
+		switch {
+		case errors.Is(err, errInvalidPattern):
+			reason = "InvalidPattern"
+		case errors.Is(err, fs.ErrNotExist):
+			reason = "PathNotFound"
+		}
+		if reason == "PathNotFound" {
+			// Commonly the monitor was created before whatever writes the
+			// files; the scan is repeated once the path appears.
+			log.Info("Path does not exist yet", "path", fm.Spec.Path)
+			markScanFailed(fm, reason, err.Error()+"; it is scanned again once it is created")
+		} else {
+			log.Error(err, "Error scanning path", "path", fm.Spec.Path)
+			markScanFailed(fm, reason, err.Error())
+		}
+		// A failed scan says nothing about which of the files listed before
+		// were removed, so they are kept, as by recordScanTimeout, and only
+		// the conditions change.
+		if err := status.write(ctx, fm); err != nil {
+			return nil, err
+		}
+		if reason == "PathNotFound" {
+			// Not a failure to retry: the path is rescanned at the scan
+			// interval, or as soon as it is created. The controller marks
+			// the FileMonitor Degraded should it stay missing; see
+			// countMissingPath.
+			return fm.Status.Files, nil
+		}
+		// Returned so that the reconcile is retried with backoff, counted as
+		// failed, and eventually marked Degraded.
+		return fm.Status.Files, fmt.Errorf("scanning %s: %w", fm.Spec.Path, err)
+	}
+
+	markScanned(fm, scanMessage(fm.Spec, result.noBtime))
+	fm.Status.ObservedGeneration = fm.Generation
+	fm.Status.LastScanTime = &now
+	fm.Status.LastScanDuration = elapsed.Milliseconds()
+	updateAvgScanDuration(fm, elapsed)
+	if !incremental {
+		fm.Status.LastFullScanTime = &now
+	}
+	fm.Status.LargeFiles = largeFiles(files, fm.Spec.LargeFileThreshold)
+	fm.Status.ContentMatches = result.matches
+	if len(corrupt) > 0 {
+		log.Info("Archive is corrupt", "reason", corrupt[0])
+		setCondition(fm, conditionArchiveReadable, metav1.ConditionFalse, "CorruptArchive",
+			strings.Join(corrupt, "; ")+"; only the entries before the damage are listed")
+	} else if fm.Spec.ArchiveMode {
+		setCondition(fm, conditionArchiveReadable, metav1.ConditionTrue, "Readable", "every archive was read to the end")
+	}
+
+	if fm.Spec.DirsOnly {
+		files = dirsOnly(files)
+	}
+	fm.Status.TotalFiles = len(files)
+	fm.Status.Summary = result.Summary
+	fm.Status.Truncated = false
+	if fm.Spec.Compact {
+		fm.Status.RootHash = merkleRoot(files)
+		fm.Status.Files = nil
+		fm.Status.LastChanges = nil
+		fm.Status.HardlinkGroups = nil
+		setCondition(fm, conditionTruncated, metav1.ConditionFalse, "Compact", "spec.compact is set, status.files is not listed")
+	} else {
+		recorded := files
+		if limit := fm.Spec.maxFiles(); len(recorded) > limit {
+			recorded = recorded[:limit]
+			fm.Status.Truncated = true
+			setCondition(fm, conditionTruncated, metav1.ConditionTrue, "MaxFilesExceeded",
+				fmt.Sprintf("found %d entries, only the first %d are listed in status.files", fm.Status.TotalFiles, limit))
+		} else {
+			setCondition(fm, conditionTruncated, metav1.ConditionFalse, "WithinMaxFiles", "every entry is listed in status.files")
+		}
+		fm.Status.RootHash = ""
+		if !incremental {
+			// Retained entries no longer carry their link counts, so the
+			// groups are only worked out by full scans.
+			fm.Status.HardlinkGroups = result.hardlinkGroups()
+		}
+		fm.Status.LastChanges = appendChanges(fm.Status.LastChanges, computeChanges(fm.Status.Files, recorded, now))
+		fm.Status.Files = recorded
+	}
+
+	if err := status.write(ctx, fm); err != nil {
+		return nil, err
+	}
+	status.emit(ctx, fm, files)
+
+	trackedFiles.WithLabelValues(fm.Namespace, fm.Name).Set(float64(fm.Status.TotalFiles))
+	log.Info("Updated status", "files", len(fm.Status.Files), "totalFiles", fm.Status.TotalFiles)
+	return files, nil
+}
+
+// scanDurationAlpha is the weight of the latest scan in
+// status.avgScanDuration.
+const scanDurationAlpha = 0.3
+
+// updateAvgScanDuration folds elapsed, the duration of the scan just
+// completed, into status.avgScanDuration, starting over from it when the
+// paths scanned, spec.recursive or spec.maxDepth changed since the average
+// was last updated.
+func updateAvgScanDuration(fm *FileMonitorCRD, elapsed time.Duration) {
+	h := fnv.New64a()
+	for _, path := range fm.paths() {
+		fmt.Fprintf(h, "%s\x00", path)
+	}
+	fmt.Fprintf(h, "recursive=%t maxDepth=%d", fm.Spec.recursive(), fm.Spec.MaxDepth)
+	spec := strconv.FormatUint(h.Sum64(), 16)
+
+	ms := float64(elapsed.Milliseconds())
+	if fm.Status.AvgScanDurationSpec == spec && fm.Status.AvgScanDuration > 0 {
+		ms = scanDurationAlpha*ms + (1-scanDurationAlpha)*float64(fm.Status.AvgScanDuration)
+	}
+	fm.Status.AvgScanDuration = int64(math.Round(ms))
+	fm.Status.AvgScanDurationSpec = spec
+}
+
+// recordScanTimeout marks fm as timed out after a scan was abandoned at its
+// deadline. The files recorded by the previous scan are kept, since an
+// incomplete scan says nothing about which of them were removed. The status
+// is written under a fresh deadline, as the reconcile's own has passed. The
+// returned error makes the caller retry.
+func recordScanTimeout(ctx context.Context, status *statusWriter, fm *FileMonitorCRD, elapsed time.Duration) error {
+	msg := fmt.Sprintf("scan of %s did not finish within %s", fm.Spec.Path, elapsed.Round(time.Millisecond))
+	logr.FromContextOrDiscard(ctx).Info("Scan timed out", "path", fm.Spec.Path, "elapsed", elapsed.String())
+	markScanFailed(fm, "ScanTimedOut", msg)
+	setCondition(fm, conditionScanTimedOut, metav1.ConditionTrue, "DeadlineExceeded", msg)
+
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), statusWriteTimeout)
+	defer cancel()
+	if err := status.write(writeCtx, fm); err != nil {
+		return err
+	}
+	return errors.New(msg)
+}
+
+// scanMessage describes a successful scan of spec, including the settings
+// that were applied and any FileInfo fields that could not be populated on
+// this platform. noBtime is how many of the entries found have no creation
+// time.
+func scanMessage(spec FileMonitorSpec, noBtime int) string {
+	msg := "path scanned successfully"
+	switch {
+	case spec.Recursive == nil:
+		msg += "; scanned recursively (spec.recursive defaults to true)"
+	case *spec.Recursive:
+		msg += "; scanned recursively"
+	default:
+		msg += "; scanned top level only (spec.recursive is false)"
+	}
+	if !sysStatSupported {
+		msg += "; inode numbers and file owners are not available on this platform"
+	}
+	switch {
+	case !btimeSupported:
+		msg += "; creation times (createTime) are not available on this platform"
+	case noBtime > 0:
+		msg += fmt.Sprintf("; createTime is not set for %d entries, as their filesystem, the kernel or their archive does not record creation times", noBtime)
+	}
+	if spec.CollectXattrs {
+		if xattrsSupported {
+			msg += "; extended attributes collected (spec.collectXattrs), at the cost of extra system calls per file"
+		} else {
+			msg += "; spec.collectXattrs is ignored, extended attributes are not available on this platform"
+		}
+	}
+	return msg
+}
+
+func main() {
+	args := os.Args[1:]
+	selfTest := len(args) > 0 && args[0] == selfTestCommand
+	if selfTest {
+		args = args[1:]
+	}
+	cfg, err := parseFlags(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+		os.Exit(2)
+	}
+
+	log, err := newLogger(cfg.LogLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating logger: %v\n", err)
+		os.Exit(2)
+	}
+	klog.SetLogger(log)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = logr.NewContext(ctx, log)
+
+	if selfTest {
+		if err := runSelfTest(ctx, os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			stop()
+			os.Exit(1)
+		}
+		return
+	}
+	if err := run(ctx, log, cfg); err != nil {
+		log.Error(err, "Controller exited with error")
+		stop()
+		os.Exit(1)
+	}
+}
+
+// run starts the controller and its servers and blocks until ctx is cancelled.
+// With --once it instead makes a single pass over every FileMonitor.
+func run(ctx context.Context, log logr.Logger, cfg *Config) error {
+	if cfg.Once {
+		return runOnce(ctx, log, cfg)
+	}
+
+	health := newHealthServer(cfg.EnablePprof, cfg.EnableAdminEndpoints)
+	go health.serve(ctx, log, cfg.HealthAddr)
+	if cfg.WebhookCertFile != "" {
+		go serveWebhook(ctx, log, cfg.WebhookAddr, cfg.WebhookCertFile, cfg.WebhookKeyFile)
+	}
+
+	clientset, dynamicClient, err := initKubernetesClients(cfg.Kubeconfig)
+	if err != nil {
+		return fmt.Errorf("initializing Kubernetes clients: %w", err)
+	}
+	health.markAlive()
+
+	// The controller may be deployed before the CRD, so wait for it to be
+	// served rather than failing, and report its absence through /readyz.
+	var crdPresent atomic.Bool
+	health.addReadyCheck("crd", func() error {
+		if !crdPresent.Load() {
+			return errors.New("FileMonitor CRD not installed")
+		}
+		return nil
+	})
+	if err := waitForCRD(ctx, log, clientset.Discovery(), dynamicClient, cfg.APIVersions[0], cfg.InstallCRD, &crdPresent); err != nil {
+		return err
+	}
+
+	// The API server may still be starting alongside the controller, so
+	// transient failures of the initial List are retried.
+	count := 0
+	err = retry.OnError(retry.DefaultBackoff, isTransientAPIError, func() error {
+		count = 0
+		return listFileMonitors(ctx, dynamicClient, cfg.APIVersions[0], cfg.namespaces(), cfg.Selector, cfg.ListPageSize, func(page *unstructured.UnstructuredList) error {
+			count += len(page.Items)
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("listing FileMonitors: %w", err)
+	}
+	if len(cfg.Namespaces) == 0 {
+		log.Info("Watching FileMonitors in all namespaces", "count", count)
+	} else {
+		log.Info("Watching FileMonitors", "namespaces", cfg.Namespaces, "count", count)
+	}
+
+	go serveMetrics(ctx, log, cfg.MetricsAddr)
+
+	controller := NewController(log, clientset, dynamicClient, cfg)
+	controller.status.detectSubresource(log, clientset.Discovery(), cfg.APIVersions[0])
+	health.setReconcile(controller.reconcileNow)
+	if cfg.GRPCAddr != "" {
+		go serveGRPC(ctx, log.WithName("grpc"), cfg.GRPCAddr, controller.feed)
+	}
+	if cfg.WebSocketAddr != "" {
+		go serveWebSocket(ctx, log.WithName("websocket"), cfg.WebSocketAddr, controller.feed)
+	}
+	if !cfg.LeaderElect {
+		health.addReadyCheck("informer", controller.checkSynced)
+		return controller.Run(ctx, cfg.ShutdownGracePeriod)
+	}
+
+	// A standby replica is ready to take over, so the informer only gates
+	// readiness while this replica is leading.
+	var leading atomic.Bool
+	health.addReadyCheck("informer", func() error {
+		if !leading.Load() {
+			return nil
+		}
+		return controller.checkSynced()
+	})
+	return runWithLeaderElection(ctx, log, clientset, cfg, func(leaderCtx context.Context) error {
+		leading.Store(true)
+		defer leading.Store(false)
+		return controller.Run(leaderCtx, cfg.ShutdownGracePeriod)
+	})
+}
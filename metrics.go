@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// defaultMetricsAddr is the default listen address of the metrics server.
+const defaultMetricsAddr = ":8080"
+
+var (
+	filesScanned = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "filemonitor_files_scanned_total",
+		Help: "Number of files and directories recorded by scans.",
+	}, []string{"namespace", "name"})
+
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "filemonitor_reconcile_errors_total",
+		Help: "Number of reconciles that returned an error.",
+	}, []string{"namespace", "name"})
+
+	scanDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "filemonitor_scan_duration_seconds",
+		Help:    "Time taken to scan the path of a FileMonitor.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"namespace", "name"})
+
+	trackedFiles = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "filemonitor_tracked_files",
+		Help: "Number of files and directories found by the latest scan of a FileMonitor, including any beyond spec.maxFiles.",
+	}, []string{"namespace", "name"})
+
+	crdsTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "filemonitor_crds_total",
+		Help: "Number of FileMonitors in the informer cache, by namespace.",
+	}, []string{"namespace"})
+
+	statusWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "filemonitor_status_writes_total",
+		Help: "Number of FileMonitor status writes by result: success, skipped when the status was unchanged, conflict when the object had changed since it was read, or error.",
+	}, []string{"result"})
+
+	watchErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "filemonitor_watch_errors_total",
+		Help: "Number of times a FileMonitor informer's watch failed, by reason: expired when its resourceVersion was too old and the informer relisted, or error.",
+	}, []string{"reason"})
+
+	queueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "filemonitor_queue_depth",
+		Help: "Number of FileMonitor keys waiting in the work queue, sampled as keys are added and taken.",
+	})
+
+	reconcilesInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "filemonitor_reconciles_in_flight",
+		Help: "Number of reconciles currently being run by workers.",
+	})
+
+	hashCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "filemonitor_hash_cache_hits_total",
+		Help: "Number of file digests served from the hash cache without reading the file.",
+	})
+
+	hashCacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "filemonitor_hash_cache_misses_total",
+		Help: "Number of files hashed because the hash cache held no digest for their inode, size and modification time.",
+	})
+
+	staleHashes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "filemonitor_stale_hashes_total",
+		Help: "Number of file digests recorded as stale because the file kept changing while it was hashed.",
+	})
+
+	grpcChangesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "filemonitor_grpc_changes_dropped_total",
+		Help: "Number of file changes not sent to a WatchFileChanges stream because it had fallen too far behind.",
+	})
+
+	webSocketChangesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "filemonitor_websocket_changes_dropped_total",
+		Help: "Number of file changes not sent to a WebSocket client because it had fallen too far behind.",
+	})
+)
+
+// Values of the result label of filemonitor_status_writes_total.
+const (
+	statusWriteSuccess  = "success"
+	statusWriteSkipped  = "skipped"
+	statusWriteConflict = "conflict"
+	statusWriteError    = "error"
+)
+
+// Values of the reason label of filemonitor_watch_errors_total.
+const (
+	watchErrorExpired = "expired"
+	watchErrorOther   = "error"
+)
+
+func init() {
+	prometheus.MustRegister(filesScanned, reconcileErrors, scanDuration, trackedFiles, crdsTotal, statusWrites, watchErrors, queueDepth, reconcilesInFlight, hashCacheHits, hashCacheMisses, staleHashes, grpcChangesDropped, webSocketChangesDropped)
+	// Export every result from the start, so that rates over them are
+	// defined before the first of each.
+	for _, result := range []string{statusWriteSuccess, statusWriteSkipped, statusWriteConflict, statusWriteError} {
+		statusWrites.WithLabelValues(result)
+	}
+	for _, reason := range []string{watchErrorExpired, watchErrorOther} {
+		watchErrors.WithLabelValues(reason)
+	}
+}
+
+// deleteFileMonitorMetrics drops the series of the FileMonitor
+// namespace/name once it no longer exists, so they do not linger.
+func deleteFileMonitorMetrics(namespace, name string) {
+	filesScanned.DeleteLabelValues(namespace, name)
+	reconcileErrors.DeleteLabelValues(namespace, name)
+	scanDuration.DeleteLabelValues(namespace, name)
+	trackedFiles.DeleteLabelValues(namespace, name)
+}
+
+// serveMetrics serves the Prometheus registry on addr at /metrics, and the
+// latest reconcile errors at recentErrorsPath, until ctx is cancelled.
+func serveMetrics(ctx context.Context, log logr.Logger, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle(recentErrorsPath, recentErrors)
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Error(err, "Error shutting down metrics server")
+		}
+	}()
+
+	log.Info("Serving metrics", "addr", addr, "path", "/metrics")
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error(err, "Metrics server failed")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mountInfoFile lists the mounts visible to the controller.
+const mountInfoFile = "/proc/self/mountinfo"
+
+// mountTable holds the mount points of mountInfoFile, longest first so that
+// the first prefix match is the mount a path lives on.
+type mountTable []string
+
+// loadMounts reads the mount points that paths under root, the Root of the
+// scan, live on. It returns nil when they cannot be read, such as outside
+// Linux, in which case no mount points are recorded.
+//
+// When root is /proc/<pid>/root, the root filesystem of a pod's container,
+// the controller's own table would place every path on its /proc mount, so
+// the mounts of that process are read instead and put under root, which is
+// where they are seen from here.
+func loadMounts(root string) mountTable {
+	file, prefix := mountInfoFile, ""
+	if pid, ok := procRootPID(root); ok {
+		file, prefix = "/proc/"+pid+"/mountinfo", root
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var mounts mountTable
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// Fields: mount ID, parent ID, major:minor, root, mount point, ...
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mp := unescapeMountPath(fields[4])
+		if prefix != "" {
+			mp = filepath.Join(prefix, mp)
+		}
+		mounts = append(mounts, mp)
+	}
+	if sc.Err() != nil {
+		return nil
+	}
+	sort.SliceStable(mounts, func(i, j int) bool { return len(mounts[i]) > len(mounts[j]) })
+	return mounts
+}
+
+// procRootPID returns the process ID in root if it is /proc/<pid>/root.
+func procRootPID(root string) (string, bool) {
+	rest, ok := strings.CutPrefix(filepath.Clean(root), "/proc/")
+	if !ok {
+		return "", false
+	}
+	pid, ok := strings.CutSuffix(rest, "/root")
+	if !ok || pid == "" {
+		return "", false
+	}
+	if _, err := strconv.Atoi(pid); err != nil {
+		return "", false
+	}
+	return pid, true
+}
+
+// lookup returns the mount point that the on-disk path lives on, or "" if
+// none is known.
+func (mounts mountTable) lookup(path string) string {
+	for _, mp := range mounts {
+		if mp == "/" || path == mp || strings.HasPrefix(path, mp+"/") {
+			return mp
+		}
+	}
+	return ""
+}
+
+// unescapeMountPath decodes the octal escapes, such as \040 for a space, that
+// the kernel uses for whitespace and backslashes in mountinfo paths.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
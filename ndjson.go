@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Values of --emit-target.
+const (
+	// emitTargetBoth writes status as usual besides the --emit-ndjson lines.
+	emitTargetBoth = "both"
+	// emitTargetStdout only writes the --emit-ndjson lines, leaving status
+	// alone.
+	emitTargetStdout = "stdout"
+)
+
+// ndjsonRecord is one line written by ndjsonEmitter: a file found by a scan,
+// along with the FileMonitor that found it.
+type ndjsonRecord struct {
+	Namespace   string `json:"namespace"`
+	FileMonitor string `json:"fileMonitor"`
+	FileInfo
+}
+
+// ndjsonEmitter writes the files found by each scan to w as newline-delimited
+// JSON, for log pipelines to pick up. It is safe for concurrent use; the lines
+// of one scan are never interleaved with those of another.
+type ndjsonEmitter struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+func newNDJSONEmitter(w io.Writer) *ndjsonEmitter {
+	return &ndjsonEmitter{w: bufio.NewWriter(w)}
+}
+
+// emit writes a line for each of files, found by a scan of the FileMonitor
+// namespace/name, and flushes them.
+func (e *ndjsonEmitter) emit(namespace, name string, files []FileInfo) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, f := range files {
+		if err := enc.Encode(ndjsonRecord{Namespace: namespace, FileMonitor: name, FileInfo: f}); err != nil {
+			// The lines before it are still written with this scan.
+			_ = e.w.Flush()
+			return err
+		}
+	}
+	return e.w.Flush()
+}
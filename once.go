@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+// runOnce reconciles every matching FileMonitor a single time, without an
+// informer or work queue, and returns an error naming each one that failed:
+// that either returned an error or, like one whose path is missing or whose
+// spec was rejected, did not end up Ready.
+// Finalizers are left alone, since no controller may be running to remove
+// them later.
+func runOnce(ctx context.Context, log logr.Logger, cfg *Config) error {
+	clientset, dynamicClient, err := initKubernetesClients(cfg.Kubeconfig)
+	if err != nil {
+		return fmt.Errorf("initializing Kubernetes clients: %w", err)
+	}
+	if cfg.InstallCRD {
+		if err := installCRD(ctx, dynamicClient); err != nil {
+			return err
+		}
+	}
+
+	once := *cfg
+	once.WatchMode = watchModePoll
+	once.GRPCAddr = ""
+	once.WebSocketAddr = ""
+	c := NewController(log, clientset, dynamicClient, &once)
+	c.status.detectSubresource(log, clientset.Discovery(), cfg.APIVersions[0])
+	defer c.broadcaster.Shutdown()
+	defer c.queue.ShutDown()
+
+	total := 0
+	var failed []string
+	err = listFileMonitors(ctx, dynamicClient, cfg.APIVersions[0], cfg.namespaces(), cfg.Selector, cfg.ListPageSize, func(page *unstructured.UnstructuredList) error {
+		for i := range page.Items {
+			crd := &page.Items[i]
+			if crd.GetDeletionTimestamp() != nil {
+				continue
+			}
+			key, err := cache.MetaNamespaceKeyFunc(crd)
+			if err != nil {
+				return err
+			}
+			total++
+			var fm *FileMonitorCRD
+			err = c.sync(ctx, key, func(ctx context.Context) (err error) {
+				fm, err = c.reconcileObject(ctx, key, crd)
+				return err
+			})
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", key, err))
+			} else if reason := notReady(fm); reason != "" {
+				failed = append(failed, fmt.Sprintf("%s: %s", key, reason))
+			}
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return fmt.Errorf("listing FileMonitors: %w", err)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d FileMonitors failed: %s", len(failed), total, strings.Join(failed, "; "))
+	}
+	log.Info("Reconciled every FileMonitor once", "count", total)
+	return nil
+}
+
+// notReady returns the reason and message of the Ready condition fm was left
+// with by a reconcile that returned no error, unless it is True, or "" if it
+// is. A paused or suspended FileMonitor is not scanned and counts as ready.
+func notReady(fm *FileMonitorCRD) string {
+	if isInactive(fm) {
+		return ""
+	}
+	ready := meta.FindStatusCondition(fm.Status.Conditions, conditionReady)
+	switch {
+	case ready == nil:
+		return "not scanned"
+	case ready.Status != metav1.ConditionTrue:
+		return fmt.Sprintf("not ready, %s: %s", ready.Reason, ready.Message)
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNotReady(t *testing.T) {
+	tests := []struct {
+		name string
+		// path is joined to a temporary directory, unless empty.
+		path      string
+		suspend   bool
+		wantReady bool
+	}{
+		{name: "scanned", path: ".", wantReady: true},
+		{name: "path missing", path: "missing"},
+		{name: "no path"},
+		{name: "suspended", path: "missing", suspend: true, wantReady: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := map[string]interface{}{"suspend": tt.suspend}
+			if tt.path != "" {
+				spec["path"] = filepath.Join(t.TempDir(), tt.path)
+			}
+			c, client := newTestController(t, spec)
+			fm, err := reconcileTestObject(t, c, client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reason := notReady(fm); (reason == "") != tt.wantReady {
+				t.Errorf("notReady() = %q, want ready %t", reason, tt.wantReady)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// pathTemplateData is what spec.pathTemplate is rendered with.
+type pathTemplateData struct {
+	PodUID    string
+	PodName   string
+	Namespace string
+}
+
+// parsePathTemplate parses a spec.pathTemplate.
+func parsePathTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("pathTemplate").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("spec.pathTemplate is invalid: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderPathTemplate renders spec.pathTemplate of fm for pod into fm.Spec.Path,
+// which is only changed in memory for the current reconcile.
+func renderPathTemplate(fm *FileMonitorCRD, pod *corev1.Pod) error {
+	if pod == nil {
+		return errors.New("spec.pathTemplate requires spec.podName")
+	}
+	tmpl, err := parsePathTemplate(fm.Spec.PathTemplate)
+	if err != nil {
+		return err
+	}
+
+	var path strings.Builder
+	err = tmpl.Execute(&path, pathTemplateData{PodUID: string(pod.UID), PodName: pod.Name, Namespace: pod.Namespace})
+	if err != nil {
+		return fmt.Errorf("rendering spec.pathTemplate: %w", err)
+	}
+	fm.Spec.Path = path.String()
+	return nil
+}
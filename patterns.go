@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// patternsFromIndex indexes FileMonitors by the namespace/name key of the
+// ConfigMap named by their spec.patternsFrom, so that a change to it can be
+// traced back to them.
+const patternsFromIndex = "patternsFrom"
+
+// patternsFromIndexFunc is the cache.IndexFunc of patternsFromIndex.
+func patternsFromIndexFunc(obj interface{}) ([]string, error) {
+	crd, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, nil
+	}
+	name, found, err := unstructured.NestedString(crd.Object, "spec", "patternsFrom", "name")
+	if err != nil || !found || name == "" {
+		return nil, nil
+	}
+	return []string{crd.GetNamespace() + "/" + name}, nil
+}
+
+// parsePatterns splits the value of a spec.patternsFrom key into one path or
+// pattern per line, skipping blank lines and # comments. Entries that are not
+// valid as a spec.path, or are forbidden, are returned as errors instead.
+func parsePatterns(data string, forbidden []string) ([]string, []error) {
+	var patterns []string
+	var invalid []error
+	lines := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; lines.Scan(); n++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		err := validatePath(line)
+		if err == nil {
+			err = validatePattern(line)
+		}
+		if err == nil {
+			if f := forbiddenPath(line, forbidden); f != "" {
+				err = fmt.Errorf("%q is forbidden by --forbidden-paths entry %s", line, f)
+			}
+		}
+		if err != nil {
+			invalid = append(invalid, fmt.Errorf("line %d: %w", n, err))
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, invalid
+}
+
+// loadPatterns reads the patterns of the ConfigMap key named by
+// spec.patternsFrom into fm, recording on fm whether they could be. A missing
+// ConfigMap or key leaves spec.path to be scanned on its own, and invalid
+// lines are skipped; either is retried on the next reconcile, which a change
+// to the ConfigMap triggers.
+func (c *Controller) loadPatterns(ctx context.Context, fm *FileMonitorCRD) error {
+	ref := fm.Spec.PatternsFrom
+	if ref == nil {
+		meta.RemoveStatusCondition(&fm.Status.Conditions, conditionPatternsLoaded)
+		return nil
+	}
+	c.watchConfigMaps(fm.Namespace)
+	log := logr.FromContextOrDiscard(ctx)
+
+	cm, err := c.clientset.CoreV1().ConfigMaps(fm.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		log.Info("Ignoring spec.patternsFrom", "configMap", ref.Name, "reason", "ConfigMap not found")
+		setCondition(fm, conditionPatternsLoaded, metav1.ConditionFalse, "ConfigMapNotFound",
+			fmt.Sprintf("ConfigMap %s does not exist; only spec.path is scanned", ref.Name))
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting ConfigMap %s: %w", ref.Name, err)
+	}
+	data, ok := cm.Data[ref.Key]
+	if !ok {
+		log.Info("Ignoring spec.patternsFrom", "configMap", ref.Name, "key", ref.Key, "reason", "key not found")
+		setCondition(fm, conditionPatternsLoaded, metav1.ConditionFalse, "KeyNotFound",
+			fmt.Sprintf("ConfigMap %s has no key %s; only spec.path is scanned", ref.Name, ref.Key))
+		return nil
+	}
+
+	patterns, invalid := parsePatterns(data, c.scanOpts.ForbiddenPaths)
+	fm.patterns = patterns
+	if len(invalid) > 0 {
+		log.Info("Skipping invalid patterns", "configMap", ref.Name, "key", ref.Key, "invalid", len(invalid), "reason", invalid[0].Error())
+		setCondition(fm, conditionPatternsLoaded, metav1.ConditionFalse, "InvalidPattern",
+			fmt.Sprintf("key %s of ConfigMap %s: %v; %d of %d patterns were skipped", ref.Key, ref.Name, invalid[0], len(invalid), len(invalid)+len(patterns)))
+		return nil
+	}
+	setCondition(fm, conditionPatternsLoaded, metav1.ConditionTrue, "Loaded",
+		fmt.Sprintf("loaded %d patterns from key %s of ConfigMap %s", len(patterns), ref.Key, ref.Name))
+	return nil
+}
+
+// watchConfigMaps starts an informer for the ConfigMaps of namespace, unless
+// one is running already, so that changes to those referenced by
+// spec.patternsFrom re-queue the FileMonitors using them. Informers are only
+// started for namespaces that need them, rather than caching every ConfigMap
+// of the watched namespaces. It does nothing until Run has started.
+func (c *Controller) watchConfigMaps(namespace string) {
+	c.configMapsMu.Lock()
+	defer c.configMapsMu.Unlock()
+	if c.stop == nil || c.configMaps[namespace] != nil {
+		return
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(c.clientset, 0, informers.WithNamespace(namespace))
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			// The FileMonitor that started the informer has just read the
+			// ConfigMap itself.
+			if !isInInitialList {
+				c.enqueuePatternsUsers(obj)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldCM, oldOK := oldObj.(*corev1.ConfigMap)
+			newCM, newOK := newObj.(*corev1.ConfigMap)
+			if oldOK && newOK && maps.Equal(oldCM.Data, newCM.Data) {
+				return
+			}
+			c.enqueuePatternsUsers(newObj)
+		},
+		DeleteFunc: c.enqueuePatternsUsers,
+	})
+	if err != nil {
+		c.log.Error(err, "Error adding ConfigMap event handler", "namespace", namespace)
+		return
+	}
+	c.configMaps[namespace] = factory
+	factory.Start(c.stop)
+	c.log.V(1).Info("Watching ConfigMaps for spec.patternsFrom", "namespace", namespace)
+}
+
+// enqueuePatternsUsers queues every FileMonitor whose spec.patternsFrom
+// names the ConfigMap obj.
+func (c *Controller) enqueuePatternsUsers(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.log.Error(err, "Error computing key for ConfigMap")
+		return
+	}
+	// The work queue drops the duplicates of objects seen through several
+	// versions.
+	for _, informer := range c.informersFor(key) {
+		users, err := informer.GetIndexer().ByIndex(patternsFromIndex, key)
+		if err != nil {
+			c.log.Error(err, "Error looking up FileMonitors using ConfigMap", "configMap", key)
+			return
+		}
+		for _, user := range users {
+			c.enqueue(user)
+		}
+	}
+}
+
+// startConfigMaps lets watchConfigMaps start informers, which run until stop
+// is closed.
+func (c *Controller) startConfigMaps(stop <-chan struct{}) {
+	c.configMapsMu.Lock()
+	defer c.configMapsMu.Unlock()
+	c.stop = stop
+	c.configMaps = make(map[string]informers.SharedInformerFactory)
+}
+
+// stopConfigMaps waits for every informer started by watchConfigMaps to stop.
+func (c *Controller) stopConfigMaps() {
+	c.configMapsMu.Lock()
+	factories := c.configMaps
+	c.stop, c.configMaps = nil, nil
+	c.configMapsMu.Unlock()
+	for _, factory := range factories {
+		factory.Shutdown()
+	}
+}
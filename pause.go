@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pausedAnnotation, set to "true", stops a FileMonitor from being scanned
+// until it is removed, without deleting the object.
+const pausedAnnotation = "sentinalfs.io/paused"
+
+// isPaused reports whether obj carries pausedAnnotation set to "true".
+func isPaused(obj metav1.Object) bool {
+	return obj.GetAnnotations()[pausedAnnotation] == "true"
+}
+
+// isInactive reports whether fm is not to be scanned, because it is paused
+// by pausedAnnotation or suspended by spec.suspend. Either is enough.
+func isInactive(fm *FileMonitorCRD) bool {
+	return isPaused(fm) || fm.Spec.Suspend
+}
+
+// recordPaused sets the Paused and Suspended conditions of fm from
+// pausedAnnotation and spec.suspend respectively. A condition is only
+// recorded as False once it has been True, so that FileMonitors never
+// paused or suspended do not carry them.
+func recordPaused(fm *FileMonitorCRD) {
+	switch {
+	case isPaused(fm):
+		setCondition(fm, conditionPaused, metav1.ConditionTrue, "Paused", "the "+pausedAnnotation+" annotation is set; the path is not scanned")
+	case meta.FindStatusCondition(fm.Status.Conditions, conditionPaused) != nil:
+		setCondition(fm, conditionPaused, metav1.ConditionFalse, "Resumed", "the "+pausedAnnotation+" annotation was removed")
+	}
+	switch {
+	case fm.Spec.Suspend:
+		setCondition(fm, conditionSuspended, metav1.ConditionTrue, "Suspended", "spec.suspend is true; the path is not scanned")
+	case meta.FindStatusCondition(fm.Status.Conditions, conditionSuspended) != nil:
+		setCondition(fm, conditionSuspended, metav1.ConditionFalse, "Resumed", "spec.suspend is false")
+	}
+}
+
+// pause handles fm, which is inactive, leaving the rest of its status as the
+// last scan left it. The status is only written when its Paused or Suspended
+// condition changed, and its watches are dropped; nothing is requeued, as
+// removing the annotation or clearing spec.suspend queues the object again.
+func (c *Controller) pause(ctx context.Context, key string, fm *FileMonitorCRD) error {
+	logr.FromContextOrDiscard(ctx).V(1).Info("FileMonitor is inactive, skipping scan", "paused", isPaused(fm), "suspended", fm.Spec.Suspend)
+	if c.watcher != nil {
+		c.watcher.unwatch(key)
+	}
+	return c.status.write(ctx, fm)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// cgroupRoot is where the host's cgroup hierarchy is mounted. Resolving pod
+// filesystems requires the controller to run with hostPID and this path
+// available.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// containerdTaskRoot holds the rootfs mount of every containerd-managed
+// container, named by container ID.
+const containerdTaskRoot = "/run/containerd/io.containerd.runtime.v2.task/k8s.io"
+
+// maxCgroupSearchDepth bounds the search for a pod's cgroup below cgroupRoot.
+// kubepods.slice/kubepods-burstable.slice/<pod> under cgroup v1 controllers is
+// the deepest layout in use.
+const maxCgroupSearchDepth = 5
+
+// errPodCgroupNotFound is returned when no cgroup exists for a pod UID, which
+// usually means the pod is not running on this node.
+var errPodCgroupNotFound = errors.New("pod cgroup not found")
+
+// resolvePodRootfs returns a host path through which the root filesystem of
+// the container with runtime ID containerID in the pod with podUID can be
+// read, or of its first non-sandbox container when containerID is empty. The
+// container's merged overlay mount is used when containerd's task directory is
+// visible; otherwise /proc/<pid>/root of a process in the container, which
+// the kernel resolves to the same merged view.
+func resolvePodRootfs(podUID, containerID string) (string, error) {
+	podDir, err := findPodCgroup(cgroupRoot, podUID)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := os.ReadDir(podDir)
+	if err != nil {
+		return "", fmt.Errorf("reading pod cgroup %s: %w", podDir, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if containerID != "" && containerIDFromCgroup(entry.Name()) != containerID {
+			continue
+		}
+		rootfs, ok := containerRootfs(filepath.Join(podDir, entry.Name()))
+		if ok {
+			return rootfs, nil
+		}
+	}
+	if containerID != "" {
+		return "", fmt.Errorf("container %s not found in pod cgroup %s", containerID, podDir)
+	}
+	return "", fmt.Errorf("no running container found in pod cgroup %s", podDir)
+}
+
+// podContainerID returns the runtime ID of the container called name in pod,
+// or of the first container in its spec when name is empty. The reason
+// returned with an error is suitable for a condition.
+func podContainerID(pod *corev1.Pod, name string) (id, reason string, err error) {
+	if name == "" {
+		if len(pod.Spec.Containers) == 0 {
+			return "", "ContainerNotFound", fmt.Errorf("pod %s has no containers", pod.Name)
+		}
+		name = pod.Spec.Containers[0].Name
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name != name {
+			continue
+		}
+		if cs.State.Running == nil || cs.ContainerID == "" {
+			return "", "ContainerNotRunning", fmt.Errorf("container %s of pod %s is not running", name, pod.Name)
+		}
+		// ContainerID is <runtime>://<id>.
+		_, id, _ := strings.Cut(cs.ContainerID, "://")
+		return id, "", nil
+	}
+	return "", "ContainerNotFound", fmt.Errorf("pod %s has no container %s", pod.Name, name)
+}
+
+// findPodCgroup searches root for the cgroup directory of podUID. The systemd
+// cgroup driver names it kubepods-<qos>-pod<uid>.slice with dashes in the UID
+// replaced by underscores; the cgroupfs driver uses pod<uid>.
+func findPodCgroup(root, podUID string) (string, error) {
+	names := []string{"pod" + podUID, "pod" + strings.ReplaceAll(podUID, "-", "_")}
+
+	var found string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if depthOf(root, path) > maxCgroupSearchDepth {
+			return filepath.SkipDir
+		}
+		base := strings.TrimSuffix(d.Name(), ".slice")
+		for _, name := range names {
+			if strings.HasSuffix(base, name) {
+				found = path
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if found == "" {
+		return "", fmt.Errorf("%w for uid %s", errPodCgroupNotFound, podUID)
+	}
+	return found, nil
+}
+
+// containerRootfs returns the rootfs of the container whose cgroup is dir. It
+// reports false for the pod sandbox (pause) container and for containers with
+// no running process.
+func containerRootfs(dir string) (string, bool) {
+	pid, ok := firstPID(dir)
+	if !ok {
+		return "", false
+	}
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil || strings.TrimSpace(string(comm)) == "pause" {
+		return "", false
+	}
+
+	merged := filepath.Join(containerdTaskRoot, containerIDFromCgroup(filepath.Base(dir)), "rootfs")
+	if info, err := os.Stat(merged); err == nil && info.IsDir() {
+		return merged, true
+	}
+	return fmt.Sprintf("/proc/%d/root", pid), true
+}
+
+// containerIDFromCgroup strips runtime-specific decoration from a container
+// cgroup directory name, e.g. cri-containerd-<id>.scope.
+func containerIDFromCgroup(name string) string {
+	name = strings.TrimSuffix(name, ".scope")
+	for _, prefix := range []string{"cri-containerd-", "crio-", "docker-"} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	return name
+}
+
+// firstPID returns the first process listed in the cgroup dir.
+func firstPID(dir string) (int, bool) {
+	f, err := os.Open(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if pid, err := strconv.Atoi(strings.TrimSpace(scanner.Text())); err == nil && pid > 0 {
+			return pid, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// volumeError explains why spec.pvcName could not be resolved to a path, with
+// the condition reason to record it under.
+type volumeError struct {
+	reason string
+	msg    string
+	// unsupported is set when the claim is bound to a volume of a type
+	// that has no node-local path, as opposed to one not resolvable yet.
+	unsupported bool
+}
+
+func (e *volumeError) Error() string { return e.msg }
+
+// resolvePVCPath returns the path on the node of the volume bound to the
+// PersistentVolumeClaim name in namespace, joined with subPath. Only hostPath
+// and local volumes have such a path; a local volume is only found on the
+// node it lives on. Problems with the claim or volume are returned as a
+// *volumeError, API failures as they are.
+func resolvePVCPath(ctx context.Context, clientset kubernetes.Interface, namespace, name, subPath string) (string, error) {
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", &volumeError{reason: "PVCNotFound", msg: fmt.Sprintf("PersistentVolumeClaim %s does not exist", name)}
+	}
+	if err != nil {
+		return "", fmt.Errorf("getting PersistentVolumeClaim %s: %w", name, err)
+	}
+	if pvc.Status.Phase != corev1.ClaimBound || pvc.Spec.VolumeName == "" {
+		return "", &volumeError{reason: "PVCNotBound", msg: fmt.Sprintf("PersistentVolumeClaim %s is %s, not Bound", name, pvc.Status.Phase)}
+	}
+
+	pv, err := clientset.CoreV1().PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", &volumeError{reason: "PVNotFound", msg: fmt.Sprintf("PersistentVolume %s bound to claim %s does not exist", pvc.Spec.VolumeName, name)}
+	}
+	if err != nil {
+		return "", fmt.Errorf("getting PersistentVolume %s: %w", pvc.Spec.VolumeName, err)
+	}
+
+	var root string
+	switch {
+	case pv.Spec.HostPath != nil:
+		root = pv.Spec.HostPath.Path
+	case pv.Spec.Local != nil:
+		root = pv.Spec.Local.Path
+	default:
+		return "", &volumeError{
+			reason:      "UnsupportedVolume",
+			msg:         fmt.Sprintf("PersistentVolume %s bound to claim %s is a %s volume, which has no path on the node; only hostPath and local volumes can be scanned", pv.Name, name, volumeType(pv)),
+			unsupported: true,
+		}
+	}
+	if !filepath.IsAbs(root) {
+		return "", &volumeError{reason: "UnsupportedVolume", msg: fmt.Sprintf("PersistentVolume %s has the relative path %q", pv.Name, root), unsupported: true}
+	}
+	return filepath.Join(root, subPath), nil
+}
+
+// volumeType names the volume source of pv for messages.
+func volumeType(pv *corev1.PersistentVolume) string {
+	switch {
+	case pv.Spec.CSI != nil:
+		return "CSI (" + pv.Spec.CSI.Driver + ")"
+	case pv.Spec.NFS != nil:
+		return "NFS"
+	case pv.Spec.ISCSI != nil:
+		return "iSCSI"
+	case pv.Spec.FC != nil:
+		return "Fibre Channel"
+	default:
+		return "non-local"
+	}
+}
@@ -0,0 +1,788 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// regexPrefix marks a spec.path that should be interpreted as a regular
+// expression matched against every walked path.
+const regexPrefix = "re:"
+
+// errInvalidPattern is returned when spec.path is a glob or regex that cannot
+// be compiled.
+var errInvalidPattern = errors.New("invalid path pattern")
+
+// isPattern reports whether path is a regex (re: prefix) or contains glob
+// metacharacters rather than naming a literal path.
+func isPattern(path string) bool {
+	return strings.HasPrefix(path, regexPrefix) || strings.ContainsAny(path, "*?[")
+}
+
+// scanOptions are the controller-wide settings that affect how entries are
+// recorded.
+type scanOptions struct {
+	// ComputeHash records a SHA-256 of every regular file's contents.
+	ComputeHash bool
+	// MaxHashSize skips hashing files larger than this many bytes. Zero means
+	// no limit.
+	MaxHashSize int64
+	// ForbiddenPaths lists cleaned absolute paths that spec.path may not be,
+	// or lie under; see forbiddenPath.
+	ForbiddenPaths []string
+
+	// Recursive descends into subdirectories of a literal directory path.
+	// When false only its immediate entries are recorded. Set from spec by
+	// withSpec.
+	Recursive bool
+	// MaxDepth stops a recursive walk from descending below this many levels
+	// under the root, which is depth 0. Zero means unlimited.
+	MaxDepth int
+	// Exclude holds glob patterns; entries whose base name or full path match
+	// any of them are not recorded, and excluded directories are not entered.
+	Exclude []string
+	// IncludeExtensions, when not empty, only records files whose names end
+	// in one of these lower-case extensions, each with its leading dot.
+	// Exclude still applies to them. Set from spec by withSpec.
+	IncludeExtensions []string
+	// IncludeHidden records entries whose names start with a dot, which are
+	// otherwise skipped; see hidden. Set from spec by withSpec.
+	IncludeHidden bool
+	// Root is prepended to every path before it is accessed: --host-root, or
+	// for a FileMonitor targeting a pod, the pod's root filesystem. Recorded
+	// paths, regex matches and excludes all use the logical path without
+	// Root.
+	Root string
+	// FollowSymlinks records the target of every symlink in place of the link
+	// and descends into linked directories. Set from spec by withSpec.
+	FollowSymlinks bool
+	// CollectXattrs records the extended attributes of every entry. Set from
+	// spec by withSpec.
+	CollectXattrs bool
+	// ArchiveMode lists the entries of a tar archive named by a literal path
+	// instead of just the archive; see scanArchive. Set from spec by
+	// withSpec.
+	ArchiveMode bool
+	// ContentMatch, when set, is looked for in the contents of every regular
+	// file no larger than ContentMatchMaxSize; see matchContent. Set by
+	// syncFileMonitor from spec.contentMatch.
+	ContentMatch        *regexp.Regexp
+	ContentMatchMaxSize int64
+
+	// ModifiedAfter skips entries other than directories last modified
+	// before it. Directories are still descended into, since they may hold
+	// newer files. The zero time skips nothing.
+	ModifiedAfter time.Time
+	// UnchangedSince skips entries other than directories last modified at
+	// or before it, for an incremental scan. The zero time skips nothing.
+	UnchangedSince time.Time
+
+	// hashes caches the digests computed by earlier scans. It is shared by
+	// every scan run with these options; nil caches nothing.
+	hashes *hashCache
+	// throttle paces the stats and reads of every scan run with these
+	// options; nil does not limit them.
+	throttle *ioThrottle
+
+	// mounts is read once by scanPath and shared by every entry of the scan.
+	mounts mountTable
+}
+
+// withSpec returns opts extended with the per-FileMonitor settings of spec.
+func (opts scanOptions) withSpec(spec FileMonitorSpec) scanOptions {
+	opts.Recursive = spec.recursive()
+	opts.MaxDepth = spec.MaxDepth
+	opts.Exclude = spec.Exclude
+	opts.IncludeExtensions = spec.includeExtensions()
+	opts.IncludeHidden = spec.IncludeHidden
+	opts.FollowSymlinks = spec.FollowSymlinks
+	opts.CollectXattrs = spec.CollectXattrs
+	opts.ArchiveMode = spec.ArchiveMode
+	opts.ContentMatchMaxSize = spec.contentMatchMaxSize()
+	return opts
+}
+
+// scanResult is what a scan found: the entries, and totals over them
+// accumulated as they are recorded.
+type scanResult struct {
+	Files   []FileInfo
+	Summary FileSummary
+	// root is the logical path the depth of each entry is measured from.
+	// When empty the depth the entry already carries is used.
+	root string
+	// children counts the entries recorded directly inside each directory,
+	// for Summary.MaxFanout.
+	children map[string]int
+	// links holds the paths of every file with more than one hard link.
+	links map[fileID][]string
+	// matches lists the files whose contents matched opts.ContentMatch.
+	matches []ContentMatch
+	// corrupt describes each archive that could not be read to the end; see
+	// scanArchive.
+	corrupt []string
+	// noBtime counts the entries recorded without a creation time.
+	noBtime int
+}
+
+// fileID identifies a file independently of the paths leading to it.
+type fileID struct {
+	device, inode uint64
+}
+
+// add records f.
+func (r *scanResult) add(f FileInfo) {
+	if r.root != "" {
+		f.depth = depthOf(r.root, f.Path)
+	}
+	r.Files = append(r.Files, f)
+	if r.Summary.FirstFile == "" || f.Path < r.Summary.FirstFile {
+		r.Summary.FirstFile = f.Path
+	}
+	if f.Path > r.Summary.LastFile {
+		r.Summary.LastFile = f.Path
+	}
+	r.Summary.MaxDepth = max(r.Summary.MaxDepth, f.depth)
+	if f.depth > 0 {
+		if r.children == nil {
+			r.children = make(map[string]int)
+		}
+		parent := filepath.Dir(f.Path)
+		r.children[parent]++
+		r.Summary.MaxFanout = max(r.Summary.MaxFanout, r.children[parent])
+	}
+	if f.noBtime {
+		r.noBtime++
+	}
+	if f.IsDir {
+		r.Summary.TotalDirs++
+		return
+	}
+	r.Summary.TotalFiles++
+	r.Summary.TotalBytes += f.Size
+	if f.contentLine > 0 {
+		r.matches = append(r.matches, ContentMatch{Path: f.Path, Line: f.contentLine})
+	}
+
+	if f.nlink > 1 {
+		if r.links == nil {
+			r.links = make(map[fileID][]string)
+		}
+		id := fileID{device: f.Device, inode: f.Inode}
+		r.links[id] = append(r.links[id], f.Path)
+	}
+}
+
+// dirsOnly returns the directories among files, in the same order, with
+// their ChildCount set to the number of entries of files directly inside
+// them.
+func dirsOnly(files []FileInfo) []FileInfo {
+	children := make(map[string]int)
+	for _, f := range files {
+		if parent := filepath.Dir(f.Path); parent != f.Path {
+			children[parent]++
+		}
+	}
+	var dirs []FileInfo
+	for _, f := range files {
+		if f.IsDir {
+			f.ChildCount = children[f.Path]
+			dirs = append(dirs, f)
+		}
+	}
+	return dirs
+}
+
+// hardlinkGroups returns the inodes that were reached through more than one
+// path, keyed as described on FileMonitorStatus.HardlinkGroups.
+func (r *scanResult) hardlinkGroups() map[string][]string {
+	devices := make(map[uint64]int)
+	for id, paths := range r.links {
+		if len(paths) > 1 {
+			devices[id.inode]++
+		}
+	}
+
+	var groups map[string][]string
+	for id, paths := range r.links {
+		if len(paths) < 2 {
+			continue
+		}
+		key := strconv.FormatUint(id.inode, 10)
+		if devices[id.inode] > 1 {
+			key = strconv.FormatUint(id.device, 10) + ":" + key
+		}
+		if groups == nil {
+			groups = make(map[string][]string)
+		}
+		groups[key] = paths
+	}
+	return groups
+}
+
+// scanPath returns a FileInfo for every entry described by path. A literal path
+// is walked in full, including path itself; a glob or regex pattern records
+// only the entries that match. Entries that cannot be stat'ed are skipped rather
+// than aborting the scan. The scan stops between entries with ctx.Err() once
+// ctx is done.
+func scanPath(ctx context.Context, path string, opts scanOptions) (scanResult, error) {
+	opts.mounts = loadMounts(opts.Root)
+	for _, pattern := range opts.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return scanResult{}, fmt.Errorf("%w: exclude %q: %v", errInvalidPattern, pattern, err)
+		}
+	}
+
+	if isPattern(path) {
+		return scanPattern(ctx, path, opts)
+	}
+	root := opts.physical(filepath.Clean(path))
+	if opts.ArchiveMode && isArchive(root) {
+		return scanArchive(ctx, root, opts)
+	}
+	if !opts.Recursive {
+		return scanDir(ctx, root, opts)
+	}
+	return scanTree(ctx, root, opts)
+}
+
+// scanPaths scans each of paths as scanPath does and merges the results in
+// walk order, recording an entry reached through more than one of them once.
+// A path that does not exist is skipped, unless none of them do.
+func scanPaths(ctx context.Context, paths []string, opts scanOptions) (scanResult, error) {
+	if len(paths) == 1 {
+		return scanPath(ctx, paths[0], opts)
+	}
+	var files []FileInfo
+	seen := make(map[string]struct{})
+	var corrupt []string
+	var missing error
+	found := false
+	for _, path := range paths {
+		result, err := scanPath(ctx, path, opts)
+		if errors.Is(err, fs.ErrNotExist) {
+			if missing == nil {
+				missing = err
+			}
+			continue
+		}
+		if err != nil {
+			return scanResult{}, err
+		}
+		found = true
+		corrupt = append(corrupt, result.corrupt...)
+		for _, f := range result.Files {
+			if _, ok := seen[f.Path]; !ok {
+				seen[f.Path] = struct{}{}
+				files = append(files, f)
+			}
+		}
+	}
+	if !found {
+		return scanResult{}, missing
+	}
+	sort.Slice(files, func(i, j int) bool { return walkOrderLess(files[i].Path, files[j].Path) })
+
+	merged := scanResult{Files: make([]FileInfo, 0, len(files)), corrupt: corrupt}
+	for _, f := range files {
+		merged.add(f)
+	}
+	return merged, nil
+}
+
+// scanPattern records a FileInfo for every path matching pattern.
+func scanPattern(ctx context.Context, pattern string, opts scanOptions) (scanResult, error) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	root, err := patternRoot(pattern)
+	if err != nil {
+		return scanResult{}, err
+	}
+
+	matches, err := matchFiles(ctx, opts.physical(root), pattern, opts)
+	if err != nil {
+		return scanResult{}, err
+	}
+
+	result := scanResult{Files: make([]FileInfo, 0, len(matches)), root: root}
+	for _, match := range matches {
+		if err := ctx.Err(); err != nil {
+			return scanResult{}, err
+		}
+		if opts.excluded(match) || opts.hiddenMatch(pattern, match) {
+			continue
+		}
+		if err := opts.throttle.wait(ctx); err != nil {
+			return scanResult{}, err
+		}
+		info, target, err := opts.stat(ctx, match)
+		if err != nil {
+			log.V(1).Info("Skipping entry", "path", match, "error", err.Error())
+			continue
+		}
+		if opts.recorded(match, info) {
+			result.add(linkedFileInfo(ctx, match, target, info, opts))
+		}
+	}
+	return result, nil
+}
+
+// patternRoot returns the deepest literal directory of pattern, which bounds
+// the walk needed to evaluate a regex.
+func patternRoot(pattern string) (string, error) {
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		re, err := regexp.Compile(strings.TrimPrefix(expr, "^"))
+		if err != nil {
+			return "", fmt.Errorf("%w %q: %v", errInvalidPattern, pattern, err)
+		}
+		prefix, complete := re.LiteralPrefix()
+		if complete || strings.HasSuffix(prefix, "/") {
+			return filepath.Clean("/" + prefix), nil
+		}
+		return filepath.Dir(filepath.Clean("/" + prefix)), nil
+	}
+
+	i := strings.IndexAny(pattern, "*?[")
+	return filepath.Dir(pattern[:i+1]), nil
+}
+
+// matchFiles returns the paths matching pattern. Globs are expanded with
+// filepath.Glob; regexes (prefixed with "re:") are matched against the logical
+// form of every path found by walking root, without entering directories
+// excluded by opts.
+func matchFiles(ctx context.Context, root, pattern string, opts scanOptions) ([]string, error) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	expr, ok := strings.CutPrefix(pattern, regexPrefix)
+	if !ok {
+		matches, err := filepath.Glob(opts.physical(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %v", errInvalidPattern, pattern, err)
+		}
+		return matches, nil
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", errInvalidPattern, pattern, err)
+	}
+
+	if _, err := os.Lstat(root); err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			log.V(1).Info("Skipping entry", "path", path, "error", err.Error())
+			return nil
+		}
+		if d.IsDir() && opts.excluded(path) {
+			return filepath.SkipDir
+		}
+		if opts.hidden(root, path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if re.MatchString(opts.logical(path)) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// scanDir returns a FileInfo for root and, if root is a directory, each of its
+// immediate entries without descending further. Only a failure to stat root is
+// returned as an error.
+func scanDir(ctx context.Context, root string, opts scanOptions) (scanResult, error) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	if err := opts.throttle.wait(ctx); err != nil {
+		return scanResult{}, err
+	}
+	info, dir, err := opts.stat(ctx, root)
+	if err != nil {
+		return scanResult{}, err
+	}
+	if opts.excluded(root) {
+		return scanResult{}, nil
+	}
+
+	result := scanResult{root: opts.logical(root)}
+	if opts.recorded(root, info) {
+		result.add(linkedFileInfo(ctx, root, dir, info, opts))
+	}
+	if !info.IsDir() {
+		return result, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.V(1).Info("Skipping directory entries", "path", root, "error", err.Error())
+		return result, nil
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return scanResult{}, err
+		}
+		path := filepath.Join(root, entry.Name())
+		if opts.excluded(path) || opts.hidden(root, path) {
+			continue
+		}
+		target := filepath.Join(dir, entry.Name())
+		if err := opts.throttle.wait(ctx); err != nil {
+			return scanResult{}, err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			log.V(1).Info("Skipping entry", "path", path, "error", err.Error())
+			continue
+		}
+		if opts.FollowSymlinks && info.Mode()&fs.ModeSymlink != 0 {
+			info, target = opts.follow(ctx, target, info)
+		}
+		if opts.recorded(path, info) {
+			result.add(linkedFileInfo(ctx, path, target, info, opts))
+		}
+	}
+	return result, nil
+}
+
+// scanTree walks root and returns a FileInfo for root itself and every entry
+// below it, down to opts.MaxDepth levels. Only a failure to stat root is
+// returned as an error.
+func scanTree(ctx context.Context, root string, opts scanOptions) (scanResult, error) {
+	if _, err := os.Lstat(root); err != nil {
+		return scanResult{}, err
+	}
+
+	w := &treeWalker{ctx: ctx, opts: opts, root: root, visited: make(map[string]bool)}
+	w.result.root = opts.logical(root)
+	if err := w.walk(root, root); err != nil {
+		return scanResult{}, err
+	}
+	return w.result, nil
+}
+
+// treeWalker accumulates the entries found by scanTree. When symlinks are
+// followed a linked directory is walked in turn, with its entries recorded
+// under the link's path.
+type treeWalker struct {
+	ctx    context.Context
+	opts   scanOptions
+	root   string
+	result scanResult
+	// visited holds the on-disk path of every directory descended into, so
+	// that a symlink cycle is walked at most once.
+	visited map[string]bool
+}
+
+// walk records the entries below the on-disk directory dir, which is shown in
+// status as the on-disk path shown. dir itself is only recorded when it is
+// the root of the scan; a followed link records its target before walking it.
+func (w *treeWalker) walk(dir, shown string) error {
+	log := logr.FromContextOrDiscard(w.ctx)
+
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err := w.ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			log.V(1).Info("Skipping entry", "path", path, "error", err.Error())
+			return nil
+		}
+
+		if path == dir && dir != shown {
+			w.visited[dir] = true
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		at := filepath.Join(shown, rel)
+
+		if w.opts.excluded(at) || w.opts.hidden(w.root, at) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if err := w.opts.throttle.wait(w.ctx); err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			log.V(1).Info("Skipping entry", "path", at, "error", err.Error())
+			return nil
+		}
+
+		if w.opts.FollowSymlinks && d.Type()&fs.ModeSymlink != 0 {
+			return w.followLink(path, at, info)
+		}
+
+		if w.opts.recorded(at, info) {
+			w.result.add(linkedFileInfo(w.ctx, at, path, info, w.opts))
+		}
+
+		if d.IsDir() {
+			if w.visited[path] {
+				log.V(1).Info("Directory already scanned through a symlink, not descending", "path", w.opts.logical(at))
+				return filepath.SkipDir
+			}
+			w.visited[path] = true
+			if w.opts.MaxDepth > 0 && depthOf(w.root, at) >= w.opts.MaxDepth {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+}
+
+// followLink records the target of the symlink at the on-disk path link,
+// shown in status as at, and walks it if it is a directory that has not been
+// visited yet. A directory that has been is most likely a cycle back to an
+// ancestor, so that branch is abandoned with a warning.
+func (w *treeWalker) followLink(link, at string, info os.FileInfo) error {
+	info, target := w.opts.follow(w.ctx, link, info)
+	if w.opts.recorded(at, info) {
+		w.result.add(linkedFileInfo(w.ctx, at, target, info, w.opts))
+	}
+
+	if !info.IsDir() || target == link {
+		return nil
+	}
+	if w.opts.MaxDepth > 0 && depthOf(w.root, at) >= w.opts.MaxDepth {
+		return nil
+	}
+	if w.visited[target] {
+		logr.FromContextOrDiscard(w.ctx).Info("Symlink leads to a directory already scanned, possible cycle; not descending",
+			"path", w.opts.logical(at), "target", w.opts.logical(target))
+		return nil
+	}
+	return w.walk(target, at)
+}
+
+// recorded reports whether the entry described by info, found at path, is
+// recorded: it is neither stale nor, when opts.IncludeExtensions is set, a
+// file without one of those extensions. Directories are judged by their age
+// alone, and are descended into either way.
+func (opts scanOptions) recorded(path string, info os.FileInfo) bool {
+	if opts.stale(info) {
+		return false
+	}
+	if len(opts.IncludeExtensions) == 0 || info.IsDir() {
+		return true
+	}
+	name := strings.ToLower(filepath.Base(path))
+	for _, ext := range opts.IncludeExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// stale reports whether info describes an entry too old to be recorded under
+// opts.ModifiedAfter, or left unchanged since opts.UnchangedSince.
+func (opts scanOptions) stale(info os.FileInfo) bool {
+	if info.IsDir() {
+		return false
+	}
+	if info.ModTime().Before(opts.ModifiedAfter) {
+		return true
+	}
+	return !opts.UnchangedSince.IsZero() && !info.ModTime().After(opts.UnchangedSince)
+}
+
+// physical returns the on-disk location of the logical path p.
+func (opts scanOptions) physical(p string) string {
+	if opts.Root == "" {
+		return p
+	}
+	return filepath.Join(opts.Root, p)
+}
+
+// logical strips opts.Root from the on-disk path p.
+func (opts scanOptions) logical(p string) string {
+	if opts.Root == "" {
+		return p
+	}
+	rel, err := filepath.Rel(opts.Root, p)
+	if err != nil {
+		return p
+	}
+	return filepath.Join("/", rel)
+}
+
+// excluded reports whether the base name or full logical path of path matches
+// any of the exclude patterns. The patterns are validated by scanPath.
+func (opts scanOptions) excluded(path string) bool {
+	path = opts.logical(path)
+	base := filepath.Base(path)
+	for _, pattern := range opts.Exclude {
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hidden reports whether path, found below root, is an entry whose name
+// starts with a dot, or lies in such a directory, and so is skipped unless
+// opts.IncludeHidden is set. root and the directories above it were named by
+// spec.path and are never hidden.
+func (opts scanOptions) hidden(root, path string) bool {
+	if opts.IncludeHidden {
+		return false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		if isHiddenName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenMatch reports whether match, a path matching the glob pattern, has a
+// hidden name where pattern does not spell out the leading dot, as in a "*"
+// matching ".git", and so is skipped unless opts.IncludeHidden is set. As in
+// a shell, "/home/*/.profile" still matches the hidden files it names. The
+// matches of a regex were already left out by matchFiles.
+func (opts scanOptions) hiddenMatch(pattern, match string) bool {
+	if opts.IncludeHidden || strings.HasPrefix(pattern, regexPrefix) {
+		return false
+	}
+	names := strings.Split(opts.logical(match), string(filepath.Separator))
+	patterns := strings.Split(filepath.Clean(pattern), string(filepath.Separator))
+	for i, name := range names {
+		if isHiddenName(name) && (i >= len(patterns) || !strings.HasPrefix(patterns[i], ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHiddenName reports whether the file name name starts with a dot.
+func isHiddenName(name string) bool {
+	return len(name) > 1 && name[0] == '.' && name != ".."
+}
+
+// depthOf returns how many levels path lies below root; root itself is 0.
+func depthOf(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// newFileInfo builds the FileInfo recorded in status for the on-disk path. A
+// file that cannot be hashed is still recorded, just without a hash.
+func newFileInfo(ctx context.Context, path string, info os.FileInfo, opts scanOptions) FileInfo {
+	st, _ := sysStatOf(info)
+	typ := fileType(info.Mode())
+	f := FileInfo{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		IsDir:   typ == fileTypeDir,
+		Path:    opts.logical(path),
+		Type:    typ,
+		Inode:   st.Inode,
+		UID:     st.UID,
+		GID:     st.GID,
+		Device:  st.Device,
+		nlink:   st.Nlink,
+		Mode:    info.Mode().String(),
+		Perm:    uint32(info.Mode().Perm()),
+	}
+
+	if mp := opts.mounts.lookup(path); mp != "" {
+		f.Mountpoint = mp
+		if opts.Root != "" && (mp == opts.Root || strings.HasPrefix(mp, opts.Root+"/")) {
+			f.Mountpoint = opts.logical(mp)
+		}
+	}
+
+	// statx is a stat of its own, so it takes a token like any other. Should
+	// the wait fail the scan is ending, and the entry goes without.
+	f.noBtime = true
+	if btimeSupported && opts.throttle.wait(ctx) == nil {
+		btime, ok, err := readBtime(path)
+		if err != nil {
+			logr.FromContextOrDiscard(ctx).V(1).Info("Cannot read creation time", "path", path, "error", err.Error())
+		}
+		f.CreateTime = btime
+		f.noBtime = !ok
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			logr.FromContextOrDiscard(ctx).V(1).Info("Cannot read symlink target", "path", path, "error", err.Error())
+		}
+		f.LinkTarget = target
+	}
+
+	if opts.CollectXattrs && info.Mode()&os.ModeSymlink == 0 {
+		xattrs, err := readXattrs(path)
+		if err != nil {
+			logr.FromContextOrDiscard(ctx).V(1).Info("Cannot read extended attributes", "path", path, "error", err.Error())
+		}
+		f.Xattrs = xattrs
+	}
+
+	if opts.ComputeHash && info.Mode().IsRegular() && (opts.MaxHashSize == 0 || info.Size() <= opts.MaxHashSize) {
+		sum, settled, stale, err := opts.hashes.hash(ctx, path, info, st, opts.throttle)
+		if err != nil {
+			logr.FromContextOrDiscard(ctx).Error(err, "Error hashing file", "path", path)
+		} else {
+			f.Hash = sum
+			f.HashAlgo = hashAlgoSHA256
+			f.HashStale = stale
+			if settled != info {
+				// Read again after it changed: describe the file the
+				// digest was taken of.
+				st, _ := sysStatOf(settled)
+				f.Size, f.ModTime, f.Inode = settled.Size(), settled.ModTime(), st.Inode
+			}
+		}
+	}
+
+	if opts.ContentMatch != nil && info.Mode().IsRegular() && info.Size() <= opts.ContentMatchMaxSize {
+		line, err := matchContent(ctx, path, opts.ContentMatch, opts.throttle)
+		if err != nil {
+			logr.FromContextOrDiscard(ctx).V(1).Info("Cannot match file contents", "path", path, "error", err.Error())
+		}
+		f.contentLine = line
+	}
+	return f
+}
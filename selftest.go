@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// selfTestCommand is the subcommand that runs runSelfTest instead of the
+// controller.
+const selfTestCommand = "selftest"
+
+// errSelfTestFailed is returned by runSelfTest when any check failed.
+var errSelfTestFailed = errors.New("self-test failed")
+
+// skipped is returned by a self-test check that did not apply, with the
+// reason. It does not fail the self-test.
+type skipped string
+
+func (s skipped) Error() string { return string(s) }
+
+// selfTest holds what the checks of runSelfTest share: the clients, and the
+// FileMonitor read back by the read check, whose spec.path the path check
+// falls back to.
+type selfTest struct {
+	cfg           *Config
+	clientset     kubernetes.Interface
+	dynamicClient dynamic.Interface
+	sample        *FileMonitorCRD
+}
+
+// selfTestCheck is one line of the self-test report. run returns what it
+// found, or an error saying why the check failed.
+type selfTestCheck struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+// runSelfTest checks that the controller could work as configured by cfg:
+// that the CRD is served, that it is allowed to list, watch and patch the
+// status of FileMonitors in each watched namespace, that it can read one
+// back, and that it can stat a sample path. A PASS, FAIL or SKIP line is
+// written to w for each, and errSelfTestFailed returned if any failed.
+func runSelfTest(ctx context.Context, w io.Writer, cfg *Config) error {
+	clientset, dynamicClient, err := initKubernetesClients(cfg.Kubeconfig)
+	if err != nil {
+		fmt.Fprintf(w, "FAIL  connect to the API server: %v\n", err)
+		return errSelfTestFailed
+	}
+	t := &selfTest{cfg: cfg, clientset: clientset, dynamicClient: dynamicClient}
+	return t.report(ctx, w)
+}
+
+// report runs every check in turn, writing a line to w for each.
+func (t *selfTest) report(ctx context.Context, w io.Writer) error {
+	checks := []selfTestCheck{{name: "FileMonitor CRD is served", run: t.checkCRD}}
+	for _, namespace := range t.cfg.namespaces() {
+		where := "in namespace " + namespace
+		if namespace == metav1.NamespaceAll {
+			where = "in all namespaces"
+		}
+		checks = append(checks,
+			selfTestCheck{name: "list FileMonitors " + where, run: t.checkAccess(namespace, "list", "")},
+			selfTestCheck{name: "watch FileMonitors " + where, run: t.checkAccess(namespace, "watch", "")},
+			selfTestCheck{name: "update FileMonitor status " + where, run: t.checkAccess(namespace, "patch", "status")},
+		)
+	}
+	checks = append(checks,
+		selfTestCheck{name: "read back a FileMonitor", run: t.checkRead},
+		selfTestCheck{name: "stat a sample path", run: t.checkPath},
+	)
+
+	failed := false
+	for _, check := range checks {
+		detail, err := check.run(ctx)
+		var skip skipped
+		switch {
+		case errors.As(err, &skip):
+			fmt.Fprintf(w, "SKIP  %s: %s\n", check.name, skip)
+		case err != nil:
+			failed = true
+			fmt.Fprintf(w, "FAIL  %s: %v\n", check.name, err)
+		case detail != "":
+			fmt.Fprintf(w, "PASS  %s: %s\n", check.name, detail)
+		default:
+			fmt.Fprintf(w, "PASS  %s\n", check.name)
+		}
+	}
+	if failed {
+		return errSelfTestFailed
+	}
+	return nil
+}
+
+func (t *selfTest) checkCRD(ctx context.Context) (string, error) {
+	gvr := fileMonitorGVRFor(t.cfg.APIVersions[0])
+	served, err := fileMonitorServed(t.clientset.Discovery(), gvr.Version)
+	if err != nil {
+		return "", err
+	}
+	if !served {
+		return "", fmt.Errorf("%s is not served; apply manifests/filemonitor-crd.yaml or run with --install-crd", gvr)
+	}
+	return gvr.String(), nil
+}
+
+// checkAccess returns a check that asks the API server, through a
+// SelfSubjectAccessReview, whether the controller may perform verb on
+// FileMonitors, or their subresource, in namespace.
+func (t *selfTest) checkAccess(namespace, verb, subresource string) func(context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   namespace,
+					Verb:        verb,
+					Group:       fileMonitorGVR.Group,
+					Resource:    fileMonitorGVR.Resource,
+					Subresource: subresource,
+				},
+			},
+		}
+		resp, err := t.clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return "", fmt.Errorf("creating SelfSubjectAccessReview: %w", err)
+		}
+		resource := fileMonitorGVR.Resource
+		if subresource != "" {
+			resource += "/" + subresource
+		}
+		if !resp.Status.Allowed {
+			msg := fmt.Sprintf("%s %s is not allowed; grant it to the controller's service account", verb, resource)
+			if resp.Status.Reason != "" {
+				msg += ": " + resp.Status.Reason
+			}
+			return "", errors.New(msg)
+		}
+		return fmt.Sprintf("%s %s allowed", verb, resource), nil
+	}
+}
+
+func (t *selfTest) checkRead(ctx context.Context) (string, error) {
+	errFound := errors.New("found")
+	err := listFileMonitors(ctx, t.dynamicClient, t.cfg.APIVersions[0], t.cfg.namespaces(), t.cfg.Selector, 1, func(page *unstructured.UnstructuredList) error {
+		if len(page.Items) == 0 {
+			return nil
+		}
+		fm, err := decodeFileMonitor(&page.Items[0])
+		if err != nil {
+			return err
+		}
+		t.sample = fm
+		return errFound
+	})
+	if err != nil && !errors.Is(err, errFound) {
+		return "", err
+	}
+	if t.sample == nil {
+		if t.cfg.Selector.Empty() {
+			return "", skipped("no FileMonitors exist yet")
+		}
+		return "", skipped("no FileMonitors match --selector " + t.cfg.Selector.String())
+	}
+	return t.sample.Namespace + "/" + t.sample.Name, nil
+}
+
+// checkPath stats --selftest-path, or failing that the spec.path of the
+// FileMonitor read back unless it is inside a pod, and lists it if it is a
+// directory. A pattern is checked at the directory it is matched under.
+func (t *selfTest) checkPath(ctx context.Context) (string, error) {
+	path := t.cfg.SelfTestPath
+	if path == "" && t.sample != nil && t.sample.Spec.PodName == "" {
+		path = t.sample.Spec.Path
+	}
+	if path == "" {
+		return "", skipped("set --selftest-path to check one")
+	}
+	if isPattern(path) {
+		root, err := patternRoot(path)
+		if err != nil {
+			return "", err
+		}
+		path = root
+	}
+	if f := forbiddenPath(path, t.cfg.ForbiddenPaths); f != "" {
+		return "", fmt.Errorf("%s is forbidden by --forbidden-paths entry %s", path, f)
+	}
+	physical := scanOptions{Root: t.cfg.HostRoot}.physical(path)
+	info, err := os.Stat(physical)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return physical + " is a file", nil
+	}
+	// Scanning lists directories, which needs more than stat does.
+	dir, err := os.Open(physical)
+	if err != nil {
+		return "", err
+	}
+	defer dir.Close()
+	if _, err := dir.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return physical + " is a readable directory", nil
+}
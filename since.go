@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sinceExamples lists valid forms of spec.since for error messages.
+const sinceExamples = `a duration such as "24h", "yesterday", "today", a relative time such as "2 hours ago" or "1 week 3 days ago", or a timestamp such as "2024-05-01" or "2024-05-01T15:04:05Z"`
+
+// sinceUnits maps the units accepted in a relative spec.since, singular and
+// plural, to the length of one, or zero for the calendar units, which are
+// counted with time.AddDate.
+var sinceUnits = map[string]time.Duration{
+	"second": time.Second, "seconds": time.Second, "sec": time.Second, "secs": time.Second,
+	"minute": time.Minute, "minutes": time.Minute, "min": time.Minute, "mins": time.Minute,
+	"hour": time.Hour, "hours": time.Hour, "hr": time.Hour, "hrs": time.Hour,
+	"day": 0, "days": 0,
+	"week": 0, "weeks": 0,
+	"month": 0, "months": 0,
+	"year": 0, "years": 0,
+}
+
+// sinceLayouts are the timestamp layouts accepted by spec.since. Those
+// without a zone are read in the controller's local time zone.
+var sinceLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseSince returns the cutoff that s, the value of spec.since, names
+// relative to now. Besides a Go duration, which is taken as that long ago, s
+// may be "today" or "yesterday", meaning midnight, a git-like relative time
+// such as "2 hours ago" or "2.hours.ago", or a timestamp. The cutoff must not
+// lie in the future.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	if d, err := time.ParseDuration(v); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("spec.since %q must be positive", s)
+		}
+		return now.Add(-d), nil
+	}
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var cutoff time.Time
+	switch v {
+	case "today":
+		cutoff = midnight
+	case "yesterday":
+		cutoff = midnight.AddDate(0, 0, -1)
+	default:
+		var ok bool
+		if cutoff, ok = parseSinceTimestamp(strings.TrimSpace(s), now.Location()); !ok {
+			if cutoff, ok = parseSinceAgo(v, now); !ok {
+				return time.Time{}, fmt.Errorf("spec.since %q is not a time; use %s", s, sinceExamples)
+			}
+		}
+	}
+	if cutoff.After(now) {
+		return time.Time{}, fmt.Errorf("spec.since %q lies in the future", s)
+	}
+	return cutoff, nil
+}
+
+// parseSinceTimestamp parses s in one of sinceLayouts.
+func parseSinceTimestamp(s string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range sinceLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseSinceAgo parses a relative time of one or more counts and units
+// followed by "ago", separated by spaces or dots, such as "an hour ago" or
+// "1 week 3 days ago", subtracting each from now in turn.
+func parseSinceAgo(v string, now time.Time) (time.Time, bool) {
+	words := strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == '.' || r == '\t' })
+	if len(words) < 3 || len(words)%2 == 0 || words[len(words)-1] != "ago" {
+		return time.Time{}, false
+	}
+	t := now
+	for i := 0; i < len(words)-1; i += 2 {
+		n, err := strconv.Atoi(words[i])
+		if words[i] == "a" || words[i] == "an" {
+			n, err = 1, nil
+		}
+		unit, ok := sinceUnits[words[i+1]]
+		if err != nil || n < 0 || !ok {
+			return time.Time{}, false
+		}
+		switch strings.TrimSuffix(words[i+1], "s") {
+		case "day":
+			t = t.AddDate(0, 0, -n)
+		case "week":
+			t = t.AddDate(0, 0, -7*n)
+		case "month":
+			t = t.AddDate(0, -n, 0)
+		case "year":
+			t = t.AddDate(-n, 0, 0)
+		default:
+			t = t.Add(-time.Duration(n) * unit)
+		}
+	}
+	return t, true
+}
@@ -0,0 +1,11 @@
+package main
+
+// sysStat holds the platform-specific fields of a file's metadata that are
+// recorded in FileInfo. It is filled by sysStatOf.
+type sysStat struct {
+	Inode  uint64
+	Device uint64
+	UID    uint32
+	GID    uint32
+	Nlink  uint64
+}
@@ -0,0 +1,21 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// sysStatSupported reports whether sysStatOf can return real inode numbers,
+// devices and owners on this platform.
+const sysStatSupported = true
+
+// sysStatOf returns the inode number, device and owner backing info.
+func sysStatOf(info os.FileInfo) (sysStat, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return sysStat{}, false
+	}
+	return sysStat{Inode: st.Ino, Device: uint64(st.Dev), UID: st.Uid, GID: st.Gid, Nlink: uint64(st.Nlink)}, true
+}
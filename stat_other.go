@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// sysStatSupported reports whether sysStatOf can return real inode numbers,
+// devices and owners on this platform.
+const sysStatSupported = false
+
+// sysStatOf always reports false outside Linux.
+func sysStatOf(info os.FileInfo) (sysStat, bool) {
+	return sysStat{}, false
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+// fieldManager is the server-side apply field manager that owns the status
+// written by the controller.
+const fieldManager = "filemonitor-controller"
+
+// Values of --status-write-mode.
+const (
+	// statusWriteApply sends the whole status with server-side apply.
+	statusWriteApply = "apply"
+	// statusWriteJSONPatch sends a JSON Patch of the changes to the status
+	// last read or written, falling back to a full update when that would
+	// be smaller.
+	statusWriteJSONPatch = "json-patch"
+)
+
+// watermarkInterval is how far status.lastScanTime of an incremental
+// FileMonitor may run ahead of the one stored before an otherwise unchanged
+// status is written anyway; see unchangedStatus.
+const watermarkInterval = 10 * time.Minute
+
+// statusWriteTimeout bounds a status write made after the reconcile that
+// produced it has run out of time.
+const statusWriteTimeout = 10 * time.Second
+
+// statusWriter persists FileMonitor status. In dry-run mode it logs the status
+// it would have written instead.
+type statusWriter struct {
+	client dynamic.Interface
+	dryRun bool
+	// mode is how status is sent, one of the statusWrite constants.
+	mode string
+	// mainResource is set when the CRD has no /status subresource, so that
+	// status is applied to the object itself; see detectSubresource.
+	mainResource bool
+	// ndjson receives the files found by each scan under --emit-ndjson, and
+	// is nil otherwise. With stdoutOnly set no status is written at all.
+	ndjson     *ndjsonEmitter
+	stdoutOnly bool
+	// batchSize is the most entries of status.files sent in one request, or
+	// zero for no limit.
+	batchSize int
+
+	// generations holds, by namespace/name, the generation each object was
+	// left at by the last status write in mainResource mode and the one of
+	// its spec; see restoreGeneration.
+	generationsMu sync.Mutex
+	generations   map[string]writtenGeneration
+}
+
+// writtenGeneration is the generation a status write in mainResource mode
+// bumped an object to, along with the generation and spec the status was
+// computed from.
+type writtenGeneration struct {
+	uid     types.UID
+	written int64
+	spec    int64
+	rawSpec map[string]interface{}
+}
+
+func newStatusWriter(client dynamic.Interface, dryRun bool, mode string) *statusWriter {
+	return &statusWriter{client: client, dryRun: dryRun, mode: mode, generations: make(map[string]writtenGeneration)}
+}
+
+// restoreGeneration undoes, on fm as just read, the bumps of
+// metadata.generation made by the controller's own status writes in
+// mainResource mode, so that fm.Generation is that of its spec again. Unless
+// it is, status.observedGeneration and the conditions never match it, so no
+// write is ever skipped as unchanged and every scan is a full one. The
+// generation is only restored while the object is still at the generation
+// and spec it was written with; a spec changed since, or a restart, leaves
+// it bumped, which costs one more write.
+func (w *statusWriter) restoreGeneration(fm *FileMonitorCRD) {
+	if !w.mainResource {
+		return
+	}
+	key := fm.Namespace + "/" + fm.Name
+	w.generationsMu.Lock()
+	defer w.generationsMu.Unlock()
+	g, ok := w.generations[key]
+	if !ok {
+		return
+	}
+	if g.uid != fm.UID {
+		delete(w.generations, key)
+		return
+	}
+	if fm.Generation == g.written && equality.Semantic.DeepEqual(fm.rawSpec, g.rawSpec) {
+		fm.Generation = g.spec
+	}
+}
+
+// recordGeneration remembers the generation resp, the response to a status
+// write of fm, was left at, for restoreGeneration.
+func (w *statusWriter) recordGeneration(fm *FileMonitorCRD, resp *unstructured.Unstructured) {
+	if !w.mainResource {
+		return
+	}
+	w.generationsMu.Lock()
+	defer w.generationsMu.Unlock()
+	w.generations[fm.Namespace+"/"+fm.Name] = writtenGeneration{
+		uid:     fm.UID,
+		written: resp.GetGeneration(),
+		spec:    fm.Generation,
+		rawSpec: fm.rawSpec,
+	}
+}
+
+// forget drops what is remembered about the object with key, which no longer
+// exists.
+func (w *statusWriter) forget(key string) {
+	w.generationsMu.Lock()
+	defer w.generationsMu.Unlock()
+	delete(w.generations, key)
+}
+
+// detectSubresource asks discovery whether the CRD has the /status
+// subresource and, if not, has status applied to the object itself, as the
+// subresource does not exist to write it through. Without it the API server
+// bumps metadata.generation on every status write, which reconciles have to
+// allow for. Should discovery fail the subresource is assumed, as the
+// manifest defines it. Every version is taken to be like version.
+func (w *statusWriter) detectSubresource(log logr.Logger, client discovery.DiscoveryInterface, version string) {
+	served, err := statusSubresourceServed(client, version)
+	switch {
+	case err != nil:
+		log.Error(err, "Error checking for the FileMonitor status subresource, assuming it exists")
+	case served:
+		log.Info("Writing FileMonitor status through the /status subresource")
+	default:
+		w.mainResource = true
+		log.Info("FileMonitor CRD has no /status subresource, writing status with the rest of the object; every write bumps metadata.generation")
+	}
+}
+
+// write applies the status of fm through the /status subresource, or the
+// object itself when the CRD has none, with server-side apply, or with a JSON
+// Patch under --status-write-mode=json-patch. The apply patch carries only
+// status, so it does not conflict with other writers of the object; fields
+// this controller set before and omits now are removed. Nothing is written
+// when the status only differs from the one last observed in the timing of
+// the scan, so that rescanning an unchanged tree does not create a new
+// revision of the object; see unchangedStatus. Under --emit-target=stdout
+// nothing is ever written.
+func (w *statusWriter) write(ctx context.Context, fm *FileMonitorCRD) error {
+	if w.stdoutOnly {
+		return nil
+	}
+	normalized, err := normalizeStatus(fm.Status)
+	if err != nil {
+		return err
+	}
+	if fm.observed != nil && unchangedStatus(fm.Spec, *fm.observed, normalized) {
+		logr.FromContextOrDiscard(ctx).V(1).Info("Status unchanged, not writing it")
+		statusWrites.WithLabelValues(statusWriteSkipped).Inc()
+		return nil
+	}
+
+	apply := w.apply
+	if w.batchSize > 0 && len(fm.Status.Files) > w.batchSize {
+		apply = w.applyBatched
+	}
+	if err := apply(ctx, fm); err != nil {
+		if apierrors.IsConflict(err) {
+			// The reconcile is retried from the object as it is now.
+			statusWrites.WithLabelValues(statusWriteConflict).Inc()
+		} else {
+			statusWrites.WithLabelValues(statusWriteError).Inc()
+		}
+		return err
+	}
+	statusWrites.WithLabelValues(statusWriteSuccess).Inc()
+	fm.observed = &normalized
+	return nil
+}
+
+// apply sends the status of fm, or logs it in dry-run mode.
+func (w *statusWriter) apply(ctx context.Context, fm *FileMonitorCRD) error {
+	if w.dryRun {
+		data, err := json.Marshal(fm.Status)
+		if err != nil {
+			return fmt.Errorf("encoding status: %w", err)
+		}
+		logr.FromContextOrDiscard(ctx).Info("Dry run, not writing status", "status", string(data))
+		return nil
+	}
+	if w.mode == statusWriteJSONPatch {
+		return w.patch(ctx, fm)
+	}
+
+	patch, err := json.Marshal(statusApply{
+		TypeMeta: metav1.TypeMeta{APIVersion: fm.gvr().GroupVersion().String(), Kind: fileMonitorKind},
+		Metadata: statusApplyMeta{Name: fm.Name, Namespace: fm.Namespace},
+		Status:   fm.Status,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding status: %w", err)
+	}
+
+	force := true
+	resp, err := w.client.Resource(fm.gvr()).Namespace(fm.Namespace).Patch(ctx, fm.Name, types.ApplyPatchType, patch,
+		metav1.PatchOptions{FieldManager: fieldManager, Force: &force}, w.subresources()...)
+	if err != nil {
+		return fmt.Errorf("applying status: %w", err)
+	}
+	w.recordGeneration(fm, resp)
+	fm.ResourceVersion = resp.GetResourceVersion()
+	return nil
+}
+
+// emit writes files, found by a successful scan of fm, to w.ndjson, if set.
+// A failure is only logged, as status has been written by then.
+func (w *statusWriter) emit(ctx context.Context, fm *FileMonitorCRD, files []FileInfo) {
+	if w.ndjson == nil {
+		return
+	}
+	if err := w.ndjson.emit(fm.Namespace, fm.Name, files); err != nil {
+		logr.FromContextOrDiscard(ctx).Error(err, "Error writing scan results to stdout")
+	}
+}
+
+// normalizeStatus returns status as the API server would hand it back,
+// by way of its JSON form, for comparison by write.
+func normalizeStatus(status FileMonitorStatus) (FileMonitorStatus, error) {
+	var normalized FileMonitorStatus
+	data, err := json.Marshal(status)
+	if err != nil {
+		return normalized, fmt.Errorf("encoding status: %w", err)
+	}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return normalized, fmt.Errorf("decoding status: %w", err)
+	}
+	return normalized, nil
+}
+
+// unchangedStatus reports whether current, the normalized status of a
+// FileMonitor with spec, need not be written over observed, the one last
+// read or written. The fields describing the timing of the scan itself are
+// ignored, as every rescan, full rescan or repeated failure stamps them
+// afresh, except where they are the watermarks of spec.incremental: a full
+// scan, or a lastScanTime advanced by watermarkInterval or more, is always
+// written, so that incremental scans keep building on a recent one rather
+// than every reconcile after spec.fullScanInterval being a full scan.
+func unchangedStatus(spec FileMonitorSpec, observed, current FileMonitorStatus) bool {
+	if spec.Incremental {
+		if !observed.LastFullScanTime.Equal(current.LastFullScanTime) {
+			return false
+		}
+		if current.LastScanTime != nil &&
+			(observed.LastScanTime == nil || current.LastScanTime.Sub(observed.LastScanTime.Time) >= watermarkInterval) {
+			return false
+		}
+	}
+	return reflect.DeepEqual(withoutScanTiming(observed), withoutScanTiming(current))
+}
+
+// withoutScanTiming returns status with the fields describing the timing of
+// the scan cleared.
+func withoutScanTiming(status FileMonitorStatus) FileMonitorStatus {
+	status.LastScanTime = nil
+	status.LastFullScanTime = nil
+	status.LastErrorTime = nil
+	status.LastScanDuration = 0
+	status.AvgScanDuration = 0
+	return status
+}
+
+// statusApply is the server-side apply configuration sent by write: just
+// enough to identify the object, plus the status the controller owns.
+type statusApply struct {
+	metav1.TypeMeta `json:",inline"`
+	Metadata        statusApplyMeta   `json:"metadata"`
+	Status          FileMonitorStatus `json:"status"`
+}
+
+type statusApplyMeta struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// patch sends the changes from the status of fm last read or written to its
+// current one as a JSON Patch. The patch first tests that the object is still
+// at the resourceVersion that status was read at, so that it is never applied
+// on top of a status it was not computed against. Should the patch come out
+// larger than the whole object, or there be no status to compute it against,
+// the object is updated instead.
+func (w *statusWriter) patch(ctx context.Context, fm *FileMonitorCRD) error {
+	current, err := statusJSON(fm.Status)
+	if err != nil {
+		return err
+	}
+	obj, err := encodeFileMonitor(fm)
+	if err != nil {
+		return err
+	}
+	if fm.stored == nil || fm.ResourceVersion == "" {
+		return w.update(ctx, fm, obj, current)
+	}
+
+	ops, err := diffJSON("/status", fm.stored, current)
+	if err != nil {
+		return fmt.Errorf("computing status patch: %w", err)
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	patch, err := encodeStatusPatch(fm, ops)
+	if err != nil {
+		return err
+	}
+	full, err := obj.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("encoding FileMonitor: %w", err)
+	}
+	if len(patch) > len(full) {
+		logr.FromContextOrDiscard(ctx).V(1).Info("Status patch larger than the object, updating it instead", "patchBytes", len(patch), "objectBytes", len(full))
+		return w.update(ctx, fm, obj, current)
+	}
+
+	resp, err := w.sendPatch(ctx, fm, patch)
+	if err != nil {
+		return err
+	}
+	fm.ResourceVersion = resp.GetResourceVersion()
+	fm.stored = current
+	return nil
+}
+
+// encodeStatusPatch returns the JSON Patch of ops, preceded by a test that
+// the object is still at the resourceVersion of fm.
+func encodeStatusPatch(fm *FileMonitorCRD, ops []patchOp) ([]byte, error) {
+	test, err := newPatchOp("test", "/metadata/resourceVersion", fm.ResourceVersion)
+	if err != nil {
+		return nil, fmt.Errorf("computing status patch: %w", err)
+	}
+	patch, err := json.Marshal(append([]patchOp{test}, ops...))
+	if err != nil {
+		return nil, fmt.Errorf("encoding status patch: %w", err)
+	}
+	return patch, nil
+}
+
+// sendPatch sends patch, made by encodeStatusPatch, to the status of fm. A
+// failed resourceVersion test is returned as a conflict.
+func (w *statusWriter) sendPatch(ctx context.Context, fm *FileMonitorCRD, patch []byte) (*unstructured.Unstructured, error) {
+	resp, err := w.client.Resource(fm.gvr()).Namespace(fm.Namespace).Patch(ctx, fm.Name, types.JSONPatchType, patch,
+		metav1.PatchOptions{FieldManager: fieldManager}, w.subresources()...)
+	if apierrors.IsInvalid(err) && strings.Contains(err.Error(), "/metadata/resourceVersion") {
+		// The API server reports the failed test as an invalid patch; it
+		// means the object changed since status was read.
+		err = apierrors.NewConflict(fileMonitorGVR.GroupResource(), fm.Name, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("patching status: %w", err)
+	}
+	w.recordGeneration(fm, resp)
+	return resp, nil
+}
+
+// update replaces the status of fm with a full update of obj, its encoded
+// form, whose status is current.
+func (w *statusWriter) update(ctx context.Context, fm *FileMonitorCRD, obj *unstructured.Unstructured, current map[string]interface{}) error {
+	client := w.client.Resource(fm.gvr()).Namespace(fm.Namespace)
+	opts := metav1.UpdateOptions{FieldManager: fieldManager}
+	var resp *unstructured.Unstructured
+	var err error
+	if w.mainResource {
+		resp, err = client.Update(ctx, obj, opts)
+	} else {
+		resp, err = client.UpdateStatus(ctx, obj, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("updating status: %w", err)
+	}
+	w.recordGeneration(fm, resp)
+	fm.ResourceVersion = resp.GetResourceVersion()
+	fm.stored = current
+	return nil
+}
+
+// subresources returns the subresource that status is written through, if
+// any, in the form taken by the dynamic client.
+func (w *statusWriter) subresources() []string {
+	if w.mainResource {
+		return nil
+	}
+	return []string{"status"}
+}
+
+// statusJSON returns status in the form the dynamic client decodes it to,
+// for diffing against FileMonitorCRD.stored.
+func statusJSON(status FileMonitorStatus) (map[string]interface{}, error) {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return nil, fmt.Errorf("encoding status: %w", err)
+	}
+	var m map[string]interface{}
+	if err := utiljson.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decoding status: %w", err)
+	}
+	return m, nil
+}
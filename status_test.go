@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// TestReconcileWithoutStatusSubresourceSkipsUnchanged checks that, with status
+// written to the object itself, the generation bumped by the controller's own
+// write does not make the next reconcile of an unchanged tree write again.
+func TestReconcileWithoutStatusSubresourceSkipsUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, client := newTestController(t, map[string]interface{}{"path": dir})
+	c.status.mainResource = true
+	// Without the subresource, the API server bumps metadata.generation on
+	// every write of the object, status included.
+	writes := 0
+	client.PrependReactor("*", "filemonitors", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		switch action.GetVerb() {
+		case "update":
+			obj := action.(clienttesting.UpdateAction).GetObject()
+			stored, err := client.Tracker().Get(fileMonitorGVR, "default", "m")
+			if err != nil {
+				return true, nil, err
+			}
+			storedMeta, _ := meta.Accessor(stored)
+			objMeta, _ := meta.Accessor(obj)
+			objMeta.SetGeneration(storedMeta.GetGeneration() + 1)
+			writes++
+		case "patch":
+			writes++
+		}
+		return false, nil, nil
+	})
+
+	for i := range 2 {
+		if _, err := reconcileTestObject(t, c, client); err != nil {
+			t.Fatalf("reconcile %d: %v", i+1, err)
+		}
+		if writes != 1 {
+			t.Fatalf("after reconcile %d, %d status writes, want 1", i+1, writes)
+		}
+	}
+}
+
+func TestUnchangedStatus(t *testing.T) {
+	then := metav1.NewTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	soon := metav1.NewTime(then.Add(time.Minute))
+	later := metav1.NewTime(then.Add(watermarkInterval))
+	observed := FileMonitorStatus{LastScanTime: &then, LastFullScanTime: &then, LastScanDuration: 5}
+
+	tests := []struct {
+		name        string
+		incremental bool
+		current     FileMonitorStatus
+		want        bool
+	}{
+		{
+			name:    "rescanned",
+			current: FileMonitorStatus{LastScanTime: &later, LastFullScanTime: &later, LastScanDuration: 7},
+			want:    true,
+		},
+		{
+			name:        "incremental rescan",
+			incremental: true,
+			current:     FileMonitorStatus{LastScanTime: &soon, LastFullScanTime: &then, LastScanDuration: 7},
+			want:        true,
+		},
+		{
+			name:        "incremental watermark advanced",
+			incremental: true,
+			current:     FileMonitorStatus{LastScanTime: &later, LastFullScanTime: &then},
+			want:        false,
+		},
+		{
+			name:        "incremental full scan",
+			incremental: true,
+			current:     FileMonitorStatus{LastScanTime: &soon, LastFullScanTime: &soon},
+			want:        false,
+		},
+		{
+			name:    "files changed",
+			current: FileMonitorStatus{LastScanTime: &then, LastFullScanTime: &then, TotalFiles: 1},
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := FileMonitorSpec{Incremental: tt.incremental}
+			if got := unchangedStatus(spec, observed, tt.current); got != tt.want {
+				t.Errorf("unchangedStatus() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// maxBatchConflicts bounds how often applyBatched re-reads the object after a
+// conflict before leaving the write to a retry of the reconcile.
+const maxBatchConflicts = 5
+
+// applyBatched writes the status of fm, whose status.files holds more than
+// w.batchSize entries, in several requests so that none exceeds the API
+// server's request size limit. The first is an ordinary write of the status
+// with only the first batch of files and status.scanning set; each remaining
+// batch is then appended with a JSON Patch, the last of which clears
+// status.scanning. Clients can read the files written so far in between.
+//
+// Every patch tests the resourceVersion written by the one before it. Should
+// the object change in the meantime, it is read again: if status.files still
+// holds a head of the files being written, appending resumes after it;
+// otherwise someone else rewrote the status and the conflict is returned.
+func (w *statusWriter) applyBatched(ctx context.Context, fm *FileMonitorCRD) error {
+	if w.dryRun {
+		return w.apply(ctx, fm)
+	}
+	current, err := statusJSON(fm.Status)
+	if err != nil {
+		return err
+	}
+	want, _ := current["files"].([]interface{})
+
+	partial := *fm
+	partial.Status.Files = fm.Status.Files[:w.batchSize]
+	partial.Status.Scanning = true
+	if err := w.apply(ctx, &partial); err != nil {
+		return err
+	}
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(1).Info("Writing status.files in batches", "files", len(want), "batchSize", w.batchSize)
+
+	written := w.batchSize
+	conflicts := 0
+	for {
+		var ops []patchOp
+		end := min(written+w.batchSize, len(want))
+		last := end == len(want)
+		for _, f := range want[written:end] {
+			op, err := newPatchOp("add", "/status/files/-", f)
+			if err != nil {
+				return fmt.Errorf("computing status patch: %w", err)
+			}
+			ops = append(ops, op)
+		}
+		if last {
+			ops = append(ops, patchOp{Op: "remove", Path: "/status/scanning"})
+		}
+		patch, err := encodeStatusPatch(&partial, ops)
+		if err != nil {
+			return err
+		}
+
+		resp, err := w.sendPatch(ctx, &partial, patch)
+		if apierrors.IsConflict(err) && conflicts < maxBatchConflicts {
+			conflicts++
+			resumed, rerr := w.resumeBatch(ctx, &partial, want)
+			if rerr != nil {
+				return rerr
+			}
+			if resumed < 0 {
+				return err
+			}
+			log.V(1).Info("Status changed between batches, resuming", "written", resumed)
+			written = resumed
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		partial.ResourceVersion = resp.GetResourceVersion()
+		if last {
+			break
+		}
+		written = end
+	}
+
+	fm.ResourceVersion = partial.ResourceVersion
+	fm.stored = current
+	return nil
+}
+
+// resumeBatch reads fm again after a batch conflicted, returning how many of
+// want its status.files already holds, or -1 if they are not a head of want
+// or it is no longer being written in batches. fm's resourceVersion is
+// brought up to date.
+func (w *statusWriter) resumeBatch(ctx context.Context, fm *FileMonitorCRD, want []interface{}) (int, error) {
+	obj, err := w.client.Resource(fm.gvr()).Namespace(fm.Namespace).Get(ctx, fm.Name, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("reading status after a conflict: %w", err)
+	}
+	fm.ResourceVersion = obj.GetResourceVersion()
+	if scanning, _, _ := unstructured.NestedBool(obj.Object, "status", "scanning"); !scanning {
+		return -1, nil
+	}
+	have, _, _ := unstructured.NestedSlice(obj.Object, "status", "files")
+	if len(have) > len(want) || !reflect.DeepEqual(have, want[:len(have)]) {
+		return -1, nil
+	}
+	return len(have), nil
+}
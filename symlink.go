@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr"
+)
+
+// maxSymlinkHops bounds how many links resolveLink follows in a chain, matching
+// the kernel's ELOOP limit.
+const maxSymlinkHops = 40
+
+// errSymlinkLoop is returned by resolveLink when a chain of links does not end.
+var errSymlinkLoop = errors.New("too many levels of symbolic links")
+
+// resolveLink returns the on-disk path that the symlink at the on-disk path p
+// finally points to. Absolute targets, and ".." past the top, are resolved
+// inside opts.Root so that links in a pod's filesystem never lead out onto the
+// host.
+func (opts scanOptions) resolveLink(p string) (string, error) {
+	if opts.Root == "" {
+		return filepath.EvalSymlinks(p)
+	}
+	for i := 0; i < maxSymlinkHops; i++ {
+		target, err := os.Readlink(p)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(opts.logical(p)), target)
+		}
+		p = opts.physical(filepath.Join("/", target))
+
+		info, err := os.Lstat(p)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			return p, nil
+		}
+	}
+	return "", errSymlinkLoop
+}
+
+// stat returns the FileInfo for the on-disk path p and the on-disk path it
+// describes. Symlinks are only followed when opts.FollowSymlinks is set.
+func (opts scanOptions) stat(ctx context.Context, p string) (os.FileInfo, string, error) {
+	info, err := os.Lstat(p)
+	if err != nil || !opts.FollowSymlinks || info.Mode()&fs.ModeSymlink == 0 {
+		return info, p, err
+	}
+	info, target := opts.follow(ctx, p, info)
+	return info, target, nil
+}
+
+// follow resolves the symlink at p, whose own FileInfo is link, and returns
+// the FileInfo and on-disk path of its target. A link whose target cannot be
+// resolved, such as a dangling link, is returned as itself.
+func (opts scanOptions) follow(ctx context.Context, p string, link os.FileInfo) (os.FileInfo, string) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	target, err := opts.resolveLink(p)
+	if err != nil {
+		log.V(1).Info("Not following symlink", "path", opts.logical(p), "error", err.Error())
+		return link, p
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		log.V(1).Info("Not following symlink", "path", opts.logical(p), "error", err.Error())
+		return link, p
+	}
+	return info, target
+}
+
+// linkedFileInfo builds the FileInfo for the on-disk target of a followed
+// symlink, recorded under the on-disk path shown it was reached through so
+// that status keeps the paths spec.path leads to. When nothing was followed
+// shown and target are the same.
+func linkedFileInfo(ctx context.Context, shown, target string, info os.FileInfo, opts scanOptions) FileInfo {
+	f := newFileInfo(ctx, target, info, opts)
+	f.Name = filepath.Base(shown)
+	f.Path = opts.logical(shown)
+	return f
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// ioReadSize is the most a throttled reader reads for one token.
+const ioReadSize = 64 << 10
+
+// ioThrottle bounds the filesystem operations of every scan sharing it, per
+// --scan-iops-limit. Each stat takes one token, as does each read of up to
+// ioReadSize bytes when hashing or matching file contents. A nil ioThrottle
+// never waits.
+type ioThrottle struct {
+	limiter *rate.Limiter
+}
+
+// newIOThrottle returns a throttle allowing limit operations per second, or
+// nil when limit is zero.
+func newIOThrottle(limit int) *ioThrottle {
+	if limit <= 0 {
+		return nil
+	}
+	return &ioThrottle{limiter: rate.NewLimiter(rate.Limit(limit), limit)}
+}
+
+// wait blocks until one operation is allowed. It returns an error instead if
+// ctx is done first, or its deadline would pass before then.
+func (t *ioThrottle) wait(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	if err := t.limiter.Wait(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// The wait would outlast the deadline; report it as reached, so
+		// the scan is treated as timed out.
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// reader returns r throttled to a token per read.
+func (t *ioThrottle) reader(ctx context.Context, r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, t: t}
+}
+
+type throttledReader struct {
+	ctx context.Context
+	r   io.Reader
+	t   *ioThrottle
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if err := r.t.wait(r.ctx); err != nil {
+		return 0, err
+	}
+	if len(p) > ioReadSize {
+		p = p[:ioReadSize]
+	}
+	return r.r.Read(p)
+}
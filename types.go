@@ -0,0 +1,544 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fileMonitorGVR identifies the FileMonitor custom resource.
+var fileMonitorGVR = schema.GroupVersionResource{
+	Group:    "sentinalfs.io",
+	Version:  "v1",
+	Resource: "filemonitors",
+}
+
+// Values of FileInfo.Type.
+const (
+	fileTypeRegular   = "regular"
+	fileTypeDir       = "dir"
+	fileTypeSymlink   = "symlink"
+	fileTypeSocket    = "socket"
+	fileTypeFIFO      = "fifo"
+	fileTypeBlock     = "block"
+	fileTypeChar      = "char"
+	fileTypeIrregular = "irregular"
+)
+
+// fileType returns the FileInfo.Type of an entry with the given mode.
+func fileType(mode os.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return fileTypeRegular
+	case mode.IsDir():
+		return fileTypeDir
+	case mode&os.ModeSymlink != 0:
+		return fileTypeSymlink
+	case mode&os.ModeSocket != 0:
+		return fileTypeSocket
+	case mode&os.ModeNamedPipe != 0:
+		return fileTypeFIFO
+	case mode&os.ModeCharDevice != 0:
+		// Character devices carry ModeDevice too.
+		return fileTypeChar
+	case mode&os.ModeDevice != 0:
+		return fileTypeBlock
+	default:
+		return fileTypeIrregular
+	}
+}
+
+// fileMonitorKind is the kind of the FileMonitor custom resource.
+const fileMonitorKind = "FileMonitor"
+
+// FileInfo describes a single entry found under a monitored path: a file,
+// directory, device node or any other kind that Type names.
+type FileInfo struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	// CreateTime is when the file was created, its birth time. It is only
+	// populated on Linux, and only by filesystems that record it; see the
+	// message of the ScanSucceeded condition for how many entries lack it.
+	CreateTime time.Time `json:"createTime,omitzero"`
+	// IsDir is set when Type is "dir". It predates Type and is kept for
+	// clients that only tell directories apart from everything else.
+	IsDir bool   `json:"isDir"`
+	Path  string `json:"path"`
+	Inode uint64 `json:"inode"`
+	// Type is the kind of entry: one of regular, dir, symlink, socket,
+	// fifo, block or char, or irregular for anything else.
+	Type string `json:"type,omitempty"`
+	// Mode is the file mode in ls -l form, e.g. "-rw-r--r--", and Perm its
+	// permission bits. A symlink reports the link's own mode unless
+	// spec.followSymlinks is set, in which case the entry describes the target.
+	Mode string `json:"mode,omitempty"`
+	Perm uint32 `json:"perm,omitempty"`
+	// LinkTarget is where a symlink that was not followed points, as stored
+	// in the link and without resolving it; a relative target is relative to
+	// the link's directory. It is empty for everything else, and when the
+	// link cannot be read.
+	LinkTarget string `json:"linkTarget,omitempty"`
+	// UID and GID own the file. They are only populated on Linux.
+	UID uint32 `json:"uid"`
+	GID uint32 `json:"gid"`
+	// Device identifies the filesystem holding the file and Mountpoint is
+	// where that filesystem is mounted. Both are only populated on Linux. For
+	// a pod's files Mountpoint is relative to the pod's root when the mount is
+	// inside it.
+	Device     uint64 `json:"device"`
+	Mountpoint string `json:"mountpoint,omitempty"`
+	// Xattrs holds the extended attributes of the file, such as its SELinux
+	// label, when spec.collectXattrs is set. Values that are not UTF-8 text
+	// are base64-encoded and prefixed with "0s", as getfattr does.
+	Xattrs map[string]string `json:"xattrs,omitempty"`
+	// ChildCount is how many entries the scan found directly inside a
+	// directory. It is only set when spec.dirsOnly is.
+	ChildCount int `json:"childCount,omitempty"`
+
+	// nlink is the number of hard links to the file, used to find hardlink
+	// groups without tracking every inode. It is not part of status.
+	nlink uint64
+	// contentLine is the first line matching spec.contentMatch, counting
+	// from one, or zero. It is reported through status.contentMatches.
+	contentLine int
+	// noBtime is set when CreateTime could not be populated, for the
+	// message of the ScanSucceeded condition.
+	noBtime bool
+	// depth is how many levels below the scan root the entry lies, kept
+	// so that results merged by scanPaths still report status.summary.maxDepth.
+	depth int
+
+	// Hash is the hex-encoded digest of the file contents, computed with
+	// HashAlgo. Both are empty unless hashing is enabled.
+	Hash     string `json:"hash,omitempty"`
+	HashAlgo string `json:"hashAlgo,omitempty"`
+	// HashStale is set when the file kept changing while it was hashed, so
+	// Hash may reflect a torn read of contents that never existed at once.
+	HashStale bool `json:"hashStale,omitempty"`
+}
+
+// FileMonitorSpec is the user-provided configuration of a FileMonitor.
+type FileMonitorSpec struct {
+	Path string `json:"path"`
+	// PodName names a pod in the FileMonitor's namespace whose filesystem is
+	// monitored: path is resolved inside the pod's container root filesystem,
+	// unless pathTemplate is set. When the pod is deleted, status.files is
+	// cleared.
+	PodName string `json:"podName,omitempty"`
+	// PathTemplate is a text/template rendered into path on every reconcile,
+	// with the .PodUID, .PodName and .Namespace of the spec.podName pod, e.g.
+	// /var/lib/kubelet/pods/{{ .PodUID }}/volumes. It replaces path and
+	// requires podName. The rendered path is on the node, under --host-root,
+	// not inside the pod's container.
+	PathTemplate string `json:"pathTemplate,omitempty"`
+	// PVCName names a PersistentVolumeClaim in the FileMonitor's namespace
+	// whose bound volume is scanned, at PVCSubPath within it if set, in
+	// place of path. The claim is resolved on every reconcile to the node
+	// path of its hostPath or local volume; other volume types cannot be
+	// scanned.
+	PVCName    string `json:"pvcName,omitempty"`
+	PVCSubPath string `json:"pvcSubPath,omitempty"`
+	// ContainerName picks which container of the spec.podName pod is
+	// scanned. Defaults to the first container in the pod spec.
+	ContainerName string `json:"containerName,omitempty"`
+	// Recursive controls whether subdirectories of a directory path are
+	// scanned. Defaults to true. Ignored when path names a single file.
+	Recursive *bool `json:"recursive,omitempty"`
+	// MaxDepth limits how many directory levels below path are scanned; 1
+	// records only the direct children of path. Zero means unlimited.
+	MaxDepth int `json:"maxDepth,omitempty"`
+	// Exclude lists glob patterns matched against both the base name and the
+	// full path of each entry. Matching entries are skipped; matching
+	// directories are not descended into.
+	Exclude []string `json:"exclude,omitempty"`
+	// IncludeExtensions, e.g. [".log", ".json"], records only the files
+	// whose names end in one of these extensions, compared case-insensitively.
+	// Directories are still scanned. Exclude takes precedence. Empty records
+	// every file.
+	IncludeExtensions []string `json:"includeExtensions,omitempty"`
+	// IncludeHidden records entries whose names start with a dot. They are
+	// skipped by default, hidden directories such as .git without being
+	// descended into; earlier releases recorded them, so set this to keep
+	// that behaviour. Hidden names spelled out in path are always scanned.
+	IncludeHidden bool `json:"includeHidden,omitempty"`
+	// MaxFiles caps how many entries are written to status.files. Zero means
+	// defaultMaxFiles.
+	MaxFiles int `json:"maxFiles,omitempty"`
+	// FollowSymlinks records what each symlink points to instead of the link
+	// itself, and descends into linked directories. Directories are scanned
+	// at most once, so circular links do not loop.
+	FollowSymlinks bool `json:"followSymlinks,omitempty"`
+	// ScanInterval is how often path is rescanned, as a Go duration such as
+	// "5m". Empty means the controller's --resync-interval.
+	ScanInterval string `json:"scanInterval,omitempty"`
+	// Source selects where status comes from: "filesystem", the default,
+	// scans path; "kubeletStats" instead reports the ephemeral storage usage
+	// of the podName pod from the kubelet's stats API, and path is ignored.
+	Source string `json:"source,omitempty"`
+	// NewerThan, a Go duration such as "24h", skips files last modified
+	// longer ago than this. Directories are always scanned. Empty means no
+	// limit.
+	NewerThan string `json:"newerThan,omitempty"`
+	// Since skips files last modified before the time it names, worked out
+	// afresh on every scan: "yesterday", "2 hours ago", a timestamp, or a Go
+	// duration like newerThan; see parseSince. When both are set the later
+	// cutoff applies.
+	Since string `json:"since,omitempty"`
+	// Compact records only status.rootHash and the totals instead of listing
+	// every entry in status.files, keeping status small for large trees.
+	Compact bool `json:"compact,omitempty"`
+	// LargeFileThreshold lists every file bigger than this many bytes in
+	// status.largeFiles, with an event the first time each crosses it. Zero
+	// disables the check.
+	LargeFileThreshold int64 `json:"largeFileThreshold,omitempty"`
+	// CollectXattrs records the extended attributes of every entry. Off by
+	// default, as it costs extra system calls per file. Linux only.
+	CollectXattrs bool `json:"collectXattrs,omitempty"`
+	// Incremental only looks again at files modified since the previous
+	// scan, keeping the entries recorded for the rest. Files deleted in the
+	// meantime are noticed by a full scan every FullScanInterval.
+	Incremental bool `json:"incremental,omitempty"`
+	// FullScanInterval is how often an incremental FileMonitor is scanned in
+	// full, as a Go duration. Defaults to 1h.
+	FullScanInterval string `json:"fullScanInterval,omitempty"`
+	// ContentMatch is a regular expression looked for in the contents of
+	// every regular file, line by line. Files containing it are listed in
+	// status.contentMatches. Binary files are skipped.
+	ContentMatch string `json:"contentMatch,omitempty"`
+	// ContentMatchMaxSize skips files larger than this many bytes when
+	// looking for spec.contentMatch. Defaults to 1Mi.
+	ContentMatchMaxSize int64 `json:"contentMatchMaxSize,omitempty"`
+	// PatternsFrom names a ConfigMap key holding more paths or patterns, one
+	// per line, that are scanned along with path. The ConfigMap is watched,
+	// so editing it rescans the FileMonitor.
+	PatternsFrom *PatternsSource `json:"patternsFrom,omitempty"`
+	// ArchiveMode lists the entries inside a .tar, .tar.gz or .tgz file
+	// named by path, read from the archive's headers without extracting it,
+	// after an entry for the archive itself.
+	ArchiveMode bool `json:"archiveMode,omitempty"`
+	// DirsOnly lists only the directories found in status.files, each with
+	// its childCount, for an outline of a tree too large to list in full.
+	// status.summary and status.largeFiles still cover every file.
+	DirsOnly bool `json:"dirsOnly,omitempty"`
+	// Suspend stops the FileMonitor from being scanned while true, leaving
+	// its status as the last scan left it, like a suspended CronJob. It has
+	// the same effect as the sentinalfs.io/paused annotation; either stops
+	// scanning.
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// PatternsSource selects the key of a ConfigMap in the FileMonitor's
+// namespace.
+type PatternsSource struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// defaultMaxFiles is the status.files cap applied when spec.maxFiles is unset.
+// It keeps the object well below etcd's size limit.
+const defaultMaxFiles = 1000
+
+// maxFiles returns spec.MaxFiles, defaulting to defaultMaxFiles.
+func (spec FileMonitorSpec) maxFiles() int {
+	if spec.MaxFiles == 0 {
+		return defaultMaxFiles
+	}
+	return spec.MaxFiles
+}
+
+// scanInterval parses spec.ScanInterval. It returns zero when the field is
+// unset.
+func (spec FileMonitorSpec) scanInterval() (time.Duration, error) {
+	if spec.ScanInterval == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(spec.ScanInterval)
+	if err != nil {
+		return 0, fmt.Errorf("spec.scanInterval %q is not a valid duration: %w", spec.ScanInterval, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("spec.scanInterval %q must be positive", spec.ScanInterval)
+	}
+	return d, nil
+}
+
+// newerThan parses spec.NewerThan. It returns zero when the field is unset.
+func (spec FileMonitorSpec) newerThan() (time.Duration, error) {
+	if spec.NewerThan == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(spec.NewerThan)
+	if err != nil {
+		return 0, fmt.Errorf("spec.newerThan %q is not a valid duration: %w", spec.NewerThan, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("spec.newerThan %q must be positive", spec.NewerThan)
+	}
+	return d, nil
+}
+
+// since returns the cutoff of spec.Since relative to now. It returns the zero
+// time when the field is unset.
+func (spec FileMonitorSpec) since(now time.Time) (time.Time, error) {
+	if spec.Since == "" {
+		return time.Time{}, nil
+	}
+	return parseSince(spec.Since, now)
+}
+
+// fullScanInterval parses spec.FullScanInterval. It returns zero when the
+// field is unset.
+func (spec FileMonitorSpec) fullScanInterval() (time.Duration, error) {
+	if spec.FullScanInterval == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(spec.FullScanInterval)
+	if err != nil {
+		return 0, fmt.Errorf("spec.fullScanInterval %q is not a valid duration: %w", spec.FullScanInterval, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("spec.fullScanInterval %q must be positive", spec.FullScanInterval)
+	}
+	return d, nil
+}
+
+// contentMatch compiles spec.ContentMatch. It returns nil when the field is
+// unset.
+func (spec FileMonitorSpec) contentMatch() (*regexp.Regexp, error) {
+	if spec.ContentMatch == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(spec.ContentMatch)
+	if err != nil {
+		return nil, fmt.Errorf("spec.contentMatch %q is not a valid regular expression: %w", spec.ContentMatch, err)
+	}
+	return re, nil
+}
+
+// includeExtensions returns spec.IncludeExtensions in lower case, each with
+// a leading dot.
+func (spec FileMonitorSpec) includeExtensions() []string {
+	if len(spec.IncludeExtensions) == 0 {
+		return nil
+	}
+	exts := make([]string, 0, len(spec.IncludeExtensions))
+	for _, ext := range spec.IncludeExtensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
+	}
+	return exts
+}
+
+// contentMatchMaxSize returns spec.ContentMatchMaxSize, defaulting to
+// defaultContentMatchMaxSize.
+func (spec FileMonitorSpec) contentMatchMaxSize() int64 {
+	if spec.ContentMatchMaxSize == 0 {
+		return defaultContentMatchMaxSize
+	}
+	return spec.ContentMatchMaxSize
+}
+
+// source returns spec.Source, defaulting to sourceFilesystem.
+func (spec FileMonitorSpec) source() string {
+	if spec.Source == "" {
+		return sourceFilesystem
+	}
+	return spec.Source
+}
+
+// recursive returns spec.Recursive, defaulting to true.
+func (spec FileMonitorSpec) recursive() bool {
+	return spec.Recursive == nil || *spec.Recursive
+}
+
+// FileSummary totals the entries found by a scan.
+type FileSummary struct {
+	// TotalFiles counts every entry that is not a directory.
+	TotalFiles int `json:"totalFiles"`
+	// TotalDirs counts directories, including spec.path itself.
+	TotalDirs int `json:"totalDirs"`
+	// TotalBytes sums the sizes of the entries counted by TotalFiles. The
+	// sizes reported for directories are left out, as they describe the
+	// directory itself rather than its contents.
+	TotalBytes int64 `json:"totalBytes"`
+	// FirstFile and LastFile are the lowest and highest paths, in byte
+	// order, of every entry scanned, directories included. They are empty
+	// when nothing was found.
+	FirstFile string `json:"firstFile,omitempty"`
+	LastFile  string `json:"lastFile,omitempty"`
+	// MaxDepth is how many levels below the scan root the deepest entry
+	// lies, counting the root's own entries as 1 like spec.maxDepth.
+	// MaxFanout is the most entries recorded directly inside any one
+	// directory. Together they point at the subtrees that make a scan slow
+	// or its status truncated.
+	MaxDepth  int `json:"maxDepth,omitempty"`
+	MaxFanout int `json:"maxFanout,omitempty"`
+	// Volumes lists the usage of each pod volume. It is only reported when
+	// spec.source is kubeletStats.
+	Volumes []VolumeSummary `json:"volumes,omitempty"`
+}
+
+// LargeFile is a file found to exceed spec.largeFileThreshold.
+type LargeFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// ContentMatch is a file whose contents matched spec.contentMatch.
+type ContentMatch struct {
+	Path string `json:"path"`
+	// Line is the number of the first matching line, counting from one.
+	Line int `json:"line"`
+}
+
+// VolumeSummary is the usage of one pod volume as reported by the kubelet.
+type VolumeSummary struct {
+	Name       string `json:"name"`
+	UsedBytes  int64  `json:"usedBytes"`
+	InodesUsed int64  `json:"inodesUsed"`
+}
+
+// FileMonitorStatus is the observed state written back by the controller.
+type FileMonitorStatus struct {
+	Files      []FileInfo         `json:"files,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Scanning is set while status is being written in batches under
+	// --status-batch-size, when files only holds the entries written so far.
+	Scanning bool `json:"scanning,omitempty"`
+	// ObservedGeneration is the metadata.generation of the spec that was last
+	// scanned successfully. Status is stale while it is below generation.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastScanTime is when the most recent successful scan finished.
+	LastScanTime *metav1.Time `json:"lastScanTime,omitempty"`
+	// LastFullScanTime is when the most recent scan that was not incremental
+	// finished.
+	LastFullScanTime *metav1.Time `json:"lastFullScanTime,omitempty"`
+	// LastScanDuration is how long the most recent successful scan took, in
+	// milliseconds.
+	LastScanDuration int64 `json:"lastScanDuration,omitempty"`
+	// AvgScanDuration is an exponential moving average of the durations of
+	// successful scans, in milliseconds, each weighted by scanDurationAlpha.
+	// It starts over when what is scanned changes, which
+	// AvgScanDurationSpec identifies by a digest of the scanned paths,
+	// spec.recursive and spec.maxDepth. Like LastScanDuration, a change
+	// to it alone does not cause status to be written.
+	AvgScanDuration     int64  `json:"avgScanDuration,omitempty"`
+	AvgScanDurationSpec string `json:"avgScanDurationSpec,omitempty"`
+	// LastErrorTime is when the most recent scan failed. LastScanTime is left
+	// at the previous success, so a monitor whose scans keep failing can be
+	// told apart as stale.
+	LastErrorTime *metav1.Time `json:"lastErrorTime,omitempty"`
+	// TotalFiles is the number of entries found by the scan, which exceeds
+	// len(Files) when Truncated is set.
+	TotalFiles int `json:"totalFiles"`
+	// Summary totals every entry found by the scan, including any beyond
+	// spec.maxFiles.
+	Summary FileSummary `json:"summary"`
+	// RootHash is set instead of Files when spec.compact is: a Merkle root
+	// over the path, size and modification time of every entry, so any
+	// change to the tree changes it.
+	RootHash string `json:"rootHash,omitempty"`
+	// HardlinkGroups maps an inode number to the paths found to share it,
+	// for inodes reached through more than one path. Should the same inode
+	// number occur on more than one device, the key is "device:inode".
+	HardlinkGroups map[string][]string `json:"hardlinkGroups,omitempty"`
+	// LargeFiles lists the files bigger than spec.largeFileThreshold, in
+	// path order. Unlike Files it is never truncated.
+	LargeFiles []LargeFile `json:"largeFiles,omitempty"`
+	// ContentMatches lists the files whose contents matched
+	// spec.contentMatch, in the order they were scanned. Like LargeFiles it
+	// is never truncated.
+	ContentMatches []ContentMatch `json:"contentMatches,omitempty"`
+	// Truncated is set when more entries were found than spec.maxFiles allows.
+	Truncated bool `json:"truncated,omitempty"`
+	// LastChanges lists the most recent differences between consecutive
+	// scans, oldest first, bounded to maxLastChanges entries.
+	LastChanges []FileChange `json:"lastChanges,omitempty"`
+	// PodUID is the UID of the spec.podName pod the files were recorded for.
+	PodUID types.UID `json:"podUID,omitempty"`
+}
+
+// FileMonitorCRD is the typed representation of a FileMonitor object.
+type FileMonitorCRD struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FileMonitorSpec   `json:"spec"`
+	Status FileMonitorStatus `json:"status,omitempty"`
+
+	// observed is the normalized status as last read from or written to the
+	// API server; see statusWriter.write.
+	observed *FileMonitorStatus `json:"-"`
+	// stored is the status as last read from or written to the API server,
+	// as decoded by the dynamic client, which JSON patches of status are
+	// computed against. It must not be modified.
+	stored map[string]interface{} `json:"-"`
+	// patterns holds the paths loaded from spec.patternsFrom for the current
+	// reconcile; see loadPatterns.
+	patterns []string `json:"-"`
+	// rawSpec is the spec as read, in the field names of the object's own
+	// version, which encodeFileMonitor writes back in place of Spec.
+	rawSpec map[string]interface{} `json:"-"`
+	// conversionWarnings explains the spec fields convertSpec could not
+	// carry over.
+	conversionWarnings []string `json:"-"`
+}
+
+// paths returns every path scanned for fm: spec.path followed by the
+// patterns loaded from spec.patternsFrom.
+func (fm *FileMonitorCRD) paths() []string {
+	return append([]string{fm.Spec.Path}, fm.patterns...)
+}
+
+// decodeFileMonitor converts an object read through the dynamic client, at
+// any watched version, into a FileMonitorCRD; see convertSpec. It goes through
+// JSON rather than the unstructured converter, which cannot leave the
+// unexported fields of the types alone.
+func decodeFileMonitor(u *unstructured.Unstructured) (*FileMonitorCRD, error) {
+	fm := &FileMonitorCRD{}
+	converted, warnings := convertSpec(u)
+	data, err := converted.MarshalJSON()
+	if err == nil {
+		err = json.Unmarshal(data, fm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding FileMonitor %s/%s: %w", u.GetNamespace(), u.GetName(), err)
+	}
+	if observed, err := normalizeStatus(fm.Status); err == nil {
+		fm.observed = &observed
+	}
+	fm.stored, _ = u.Object["status"].(map[string]interface{})
+	fm.rawSpec, _ = u.Object["spec"].(map[string]interface{})
+	fm.conversionWarnings = warnings
+	return fm, nil
+}
+
+// encodeFileMonitor converts fm back into an object that can be written through
+// the dynamic client. The spec is the one read, untouched by conversion or by
+// the paths a reconcile resolves into fm.Spec.
+func encodeFileMonitor(fm *FileMonitorCRD) (*unstructured.Unstructured, error) {
+	data, err := json.Marshal(fm)
+	if err != nil {
+		return nil, fmt.Errorf("encoding FileMonitor %s/%s: %w", fm.Namespace, fm.Name, err)
+	}
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("encoding FileMonitor %s/%s: %w", fm.Namespace, fm.Name, err)
+	}
+	if fm.rawSpec != nil {
+		u.Object["spec"] = fm.rawSpec
+	}
+	return u, nil
+}
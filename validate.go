@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// validatePath checks that spec.path names an absolute location. A relative
+// path would otherwise be resolved against the controller's working directory.
+// Regexes must be anchored at an absolute path, optionally after a leading ^.
+func validatePath(path string) error {
+	if expr, ok := strings.CutPrefix(path, regexPrefix); ok {
+		if !strings.HasPrefix(strings.TrimPrefix(expr, "^"), "/") {
+			return fmt.Errorf("spec.path regex %q must match absolute paths, e.g. re:^/var/log/.*", expr)
+		}
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("spec.path %q is not absolute", path)
+	}
+	return nil
+}
+
+// validateSpec checks everything about spec that can be checked without
+// touching the filesystem, returning all of the problems found joined into one
+// error. It is used by the admission webhook so that such specs are refused at
+// apply time, and by rejectInvalidSpec where the webhook is not deployed.
+func validateSpec(spec FileMonitorSpec) error {
+	var errs []error
+	switch spec.source() {
+	case sourceFilesystem:
+		if spec.PathTemplate != "" {
+			if spec.Path != "" {
+				errs = append(errs, errors.New("spec.path and spec.pathTemplate are mutually exclusive"))
+			}
+			if spec.PodName == "" {
+				errs = append(errs, errors.New("spec.pathTemplate requires spec.podName"))
+			}
+			if spec.PVCName != "" {
+				errs = append(errs, errors.New("spec.pathTemplate and spec.pvcName are mutually exclusive"))
+			}
+			if _, err := parsePathTemplate(spec.PathTemplate); err != nil {
+				errs = append(errs, err)
+			}
+		} else if spec.PVCName != "" {
+			if spec.Path != "" {
+				errs = append(errs, errors.New("spec.path and spec.pvcName are mutually exclusive"))
+			}
+			if spec.PodName != "" {
+				errs = append(errs, errors.New("spec.pvcName and spec.podName are mutually exclusive"))
+			}
+			if spec.PVCSubPath != "" && !filepath.IsLocal(spec.PVCSubPath) {
+				errs = append(errs, fmt.Errorf("spec.pvcSubPath %q must be a relative path within the volume", spec.PVCSubPath))
+			}
+		} else if spec.Path == "" {
+			errs = append(errs, errors.New("spec.path must not be empty"))
+		} else if err := validatePath(spec.Path); err != nil {
+			errs = append(errs, err)
+		} else if err := validatePattern(spec.Path); err != nil {
+			errs = append(errs, err)
+		}
+	case sourceKubeletStats:
+		if spec.PodName == "" {
+			errs = append(errs, fmt.Errorf("spec.podName is required when spec.source is %s", sourceKubeletStats))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("spec.source must be %q or %q, got %q", sourceFilesystem, sourceKubeletStats, spec.Source))
+	}
+	if spec.PatternsFrom != nil {
+		if spec.source() != sourceFilesystem {
+			errs = append(errs, fmt.Errorf("spec.patternsFrom requires spec.source %s", sourceFilesystem))
+		}
+		if spec.PatternsFrom.Name == "" || spec.PatternsFrom.Key == "" {
+			errs = append(errs, errors.New("spec.patternsFrom requires both name and key"))
+		}
+	}
+	if spec.PVCSubPath != "" && spec.PVCName == "" {
+		errs = append(errs, errors.New("spec.pvcSubPath requires spec.pvcName"))
+	}
+	if spec.ContainerName != "" && spec.PodName == "" {
+		errs = append(errs, errors.New("spec.containerName requires spec.podName"))
+	}
+	if spec.MaxDepth < 0 {
+		errs = append(errs, fmt.Errorf("spec.maxDepth must not be negative, got %d", spec.MaxDepth))
+	}
+	if spec.LargeFileThreshold < 0 {
+		errs = append(errs, fmt.Errorf("spec.largeFileThreshold must not be negative, got %d", spec.LargeFileThreshold))
+	}
+	if spec.ContentMatchMaxSize < 0 {
+		errs = append(errs, fmt.Errorf("spec.contentMatchMaxSize must not be negative, got %d", spec.ContentMatchMaxSize))
+	}
+	if _, err := spec.contentMatch(); err != nil {
+		errs = append(errs, err)
+	}
+	if spec.MaxFiles < 0 {
+		errs = append(errs, fmt.Errorf("spec.maxFiles must not be negative, got %d", spec.MaxFiles))
+	}
+	for _, pattern := range spec.Exclude {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("spec.exclude pattern %q is invalid: %v", pattern, err))
+		}
+	}
+	for _, ext := range spec.IncludeExtensions {
+		if strings.Trim(ext, ".") == "" || strings.Contains(ext, "/") {
+			errs = append(errs, fmt.Errorf("spec.includeExtensions entry %q is not a file extension", ext))
+		}
+	}
+	if _, err := spec.scanInterval(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := spec.newerThan(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := spec.since(time.Now()); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := spec.fullScanInterval(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// validatePattern checks that a glob or regex spec.path compiles. Literal
+// paths are always valid.
+func validatePattern(path string) error {
+	if !isPattern(path) {
+		return nil
+	}
+	if _, ok := strings.CutPrefix(path, regexPrefix); ok {
+		_, err := patternRoot(path)
+		return err
+	}
+	if _, err := filepath.Match(path, ""); err != nil {
+		return fmt.Errorf("%w %q: %v", errInvalidPattern, path, err)
+	}
+	return nil
+}
+
+// defaultForbiddenPaths is the default for --forbidden-paths.
+const defaultForbiddenPaths = "/,/proc,/sys,/dev"
+
+// forbiddenPath returns the entry of forbidden that path is, or lies under,
+// or "" if there is none. Patterns are judged by the directory their
+// evaluation starts from. A forbidden "/" only forbids scanning from the root
+// itself, since every path lies under it.
+func forbiddenPath(path string, forbidden []string) string {
+	root := path
+	if isPattern(path) {
+		var err error
+		if root, err = patternRoot(path); err != nil {
+			return ""
+		}
+	}
+	root = filepath.Clean(root)
+	for _, f := range forbidden {
+		if root == f || (f != "/" && strings.HasPrefix(root, f+"/")) {
+			return f
+		}
+	}
+	return ""
+}
+
+// rejectInvalidPath validates spec.path before anything on disk is touched.
+// When it is invalid, or lies within one of forbidden, fm is marked Degraded,
+// its status written, and true is returned so the caller skips the scan.
+func rejectInvalidPath(ctx context.Context, status *statusWriter, fm *FileMonitorCRD, forbidden []string) (bool, error) {
+	reason := "InvalidPath"
+	err := validatePath(fm.Spec.Path)
+	if err == nil {
+		f := forbiddenPath(fm.Spec.Path, forbidden)
+		if f == "" {
+			return false, nil
+		}
+		reason = "PathForbidden"
+		err = fmt.Errorf("spec.path %q is forbidden by --forbidden-paths entry %s", fm.Spec.Path, f)
+	}
+
+	logr.FromContextOrDiscard(ctx).Info("Rejecting invalid spec.path", "path", fm.Spec.Path, "reason", err.Error())
+	markScanFailed(fm, reason, err.Error())
+	setCondition(fm, conditionDegraded, metav1.ConditionTrue, reason, err.Error()+"; the path was not scanned")
+	return true, status.write(ctx, fm)
+}
+
+// rejectInvalidSpec refuses to scan fm when its spec fails validateSpec, as
+// happens on clusters without the admission webhook, recording every problem
+// at once in the InvalidSpec condition. It reports whether fm was rejected.
+// The spec must be checked as written, before reconcile resolves
+// spec.pathTemplate or spec.pvcName into spec.path.
+func rejectInvalidSpec(ctx context.Context, status *statusWriter, fm *FileMonitorCRD) (bool, error) {
+	err := validateSpec(fm.Spec)
+	if err == nil {
+		setCondition(fm, conditionInvalidSpec, metav1.ConditionFalse, "Valid", "spec is valid")
+		return false, nil
+	}
+
+	msg := strings.ReplaceAll(err.Error(), "\n", "; ")
+	logr.FromContextOrDiscard(ctx).Info("Rejecting invalid spec", "reason", msg)
+	setCondition(fm, conditionInvalidSpec, metav1.ConditionTrue, "InvalidSpec", msg)
+	markScanFailed(fm, "InvalidSpec", msg)
+	setCondition(fm, conditionDegraded, metav1.ConditionTrue, "InvalidSpec", msg+"; nothing was scanned")
+	return true, status.write(ctx, fm)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+)
+
+// Values of --watch-mode.
+const (
+	watchModePoll    = "poll"
+	watchModeInotify = "inotify"
+)
+
+// maxUserWatchesFile holds the per-user inotify watch limit.
+const maxUserWatchesFile = "/proc/sys/fs/inotify/max_user_watches"
+
+// fsWatcher maps inotify events on monitored directories back to the
+// FileMonitors that cover them. A FileMonitor whose directories cannot all be
+// watched falls back to being polled on the resync interval.
+type fsWatcher struct {
+	log    logr.Logger
+	w      *fsnotify.Watcher
+	notify func(key string)
+	limit  int
+
+	mu sync.Mutex
+	// dirKeys maps each watched directory to the keys of the FileMonitors
+	// that cover it.
+	dirKeys map[string]map[string]struct{}
+	// keys maps each FileMonitor key to the directories watched for it.
+	keys map[string]*watchSet
+}
+
+// watchSet is the watch state of one FileMonitor.
+type watchSet struct {
+	dirs      map[string]struct{}
+	recursive bool
+	// polling is set once the FileMonitor has fallen back to resync polling.
+	polling bool
+}
+
+// newFSWatcher creates an inotify watcher that calls notify with the key of
+// every FileMonitor affected by a change.
+func newFSWatcher(log logr.Logger, notify func(key string)) (*fsWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &fsWatcher{
+		log:     log,
+		w:       w,
+		notify:  notify,
+		limit:   maxUserWatches(),
+		dirKeys: make(map[string]map[string]struct{}),
+		keys:    make(map[string]*watchSet),
+	}, nil
+}
+
+// maxUserWatches returns the inotify watch limit, or 0 if it is unknown.
+func maxUserWatches() int {
+	data, err := os.ReadFile(maxUserWatchesFile)
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// run dispatches inotify events until ctx is cancelled, then closes the
+// watcher.
+func (fw *fsWatcher) run(ctx context.Context) {
+	defer fw.w.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-fw.w.Events:
+			if !ok {
+				return
+			}
+			fw.handle(ev)
+		case err, ok := <-fw.w.Errors:
+			if !ok {
+				return
+			}
+			fw.log.Error(err, "inotify watcher error")
+		}
+	}
+}
+
+// handle notifies every FileMonitor covering the directory of ev. For
+// recursive monitors, a directory that is created is watched along with
+// everything already inside it; a directory that is removed or renamed away
+// has its watches, and those of the directories below it, dropped.
+func (fw *fsWatcher) handle(ev fsnotify.Event) {
+	if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) && !ev.Has(fsnotify.Remove) && !ev.Has(fsnotify.Rename) {
+		return
+	}
+	removed := ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename)
+	created := false
+	if ev.Has(fsnotify.Create) {
+		info, err := os.Lstat(ev.Name)
+		created = err == nil && info.IsDir()
+	}
+
+	fw.mu.Lock()
+	affected := make(map[string]struct{})
+	for key := range fw.dirKeys[filepath.Dir(ev.Name)] {
+		affected[key] = struct{}{}
+	}
+	if removed {
+		// A watched directory also reports its own removal.
+		for key := range fw.dirKeys[ev.Name] {
+			affected[key] = struct{}{}
+		}
+	}
+
+	keys := make([]string, 0, len(affected))
+	for key := range affected {
+		keys = append(keys, key)
+		set := fw.keys[key]
+		switch {
+		case removed:
+			fw.removeTreeLocked(key, set, ev.Name)
+		case created && set.recursive && !set.polling:
+			fw.addTreeLocked(key, set, ev.Name)
+		}
+	}
+	fw.mu.Unlock()
+
+	fw.log.V(1).Info("Filesystem change", "path", ev.Name, "op", ev.Op.String(), "monitors", len(keys))
+	for _, key := range keys {
+		fw.notify(key)
+	}
+}
+
+// watch makes dirs the set of directories watched for key, adding and
+// removing inotify watches as needed.
+func (fw *fsWatcher) watch(key string, dirs []string, recursive bool) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	set, ok := fw.keys[key]
+	if !ok {
+		set = &watchSet{dirs: make(map[string]struct{})}
+		fw.keys[key] = set
+	}
+	set.recursive = recursive
+	if set.polling {
+		return
+	}
+
+	wanted := make(map[string]struct{}, len(dirs))
+	for _, dir := range dirs {
+		wanted[dir] = struct{}{}
+	}
+	for dir := range set.dirs {
+		if _, ok := wanted[dir]; !ok {
+			fw.removeLocked(key, set, dir)
+		}
+	}
+	for dir := range wanted {
+		if !fw.addLocked(key, set, dir) {
+			return
+		}
+	}
+}
+
+// unwatch drops every watch held for key.
+func (fw *fsWatcher) unwatch(key string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	set, ok := fw.keys[key]
+	if !ok {
+		return
+	}
+	for dir := range set.dirs {
+		fw.removeLocked(key, set, dir)
+	}
+	delete(fw.keys, key)
+}
+
+// addLocked watches dir on behalf of key. If the inotify limit would be
+// exceeded, key falls back to polling: its watches are dropped and false is
+// returned.
+func (fw *fsWatcher) addLocked(key string, set *watchSet, dir string) bool {
+	if _, ok := set.dirs[dir]; ok {
+		return true
+	}
+
+	if _, watched := fw.dirKeys[dir]; !watched {
+		var err error
+		if fw.limit > 0 && len(fw.dirKeys) >= fw.limit {
+			err = syscall.ENOSPC
+		} else {
+			err = fw.w.Add(dir)
+		}
+		if errors.Is(err, syscall.ENOSPC) {
+			fw.log.Info("inotify watch limit reached, falling back to polling", "key", key, "limit", fw.limit)
+			for d := range set.dirs {
+				fw.removeLocked(key, set, d)
+			}
+			set.polling = true
+			return false
+		}
+		if err != nil {
+			fw.log.V(1).Info("Cannot watch directory", "key", key, "path", dir, "error", err.Error())
+			return true
+		}
+		fw.dirKeys[dir] = make(map[string]struct{})
+	}
+
+	fw.dirKeys[dir][key] = struct{}{}
+	set.dirs[dir] = struct{}{}
+	return true
+}
+
+// addTreeLocked watches dir and every directory below it on behalf of key,
+// stopping early if key falls back to polling.
+func (fw *fsWatcher) addTreeLocked(key string, set *watchSet, dir string) {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if !fw.addLocked(key, set, path) {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		fw.log.V(1).Info("Cannot watch new directory", "key", key, "path", dir, "error", err.Error())
+	}
+}
+
+// removeTreeLocked stops watching dir and every directory below it on behalf
+// of key.
+func (fw *fsWatcher) removeTreeLocked(key string, set *watchSet, dir string) {
+	prefix := dir + string(filepath.Separator)
+	for d := range set.dirs {
+		if d == dir || strings.HasPrefix(d, prefix) {
+			fw.removeLocked(key, set, d)
+		}
+	}
+}
+
+// removeLocked stops watching dir on behalf of key, removing the inotify
+// watch once no FileMonitor covers it.
+func (fw *fsWatcher) removeLocked(key string, set *watchSet, dir string) {
+	delete(set.dirs, dir)
+	keys, ok := fw.dirKeys[dir]
+	if !ok {
+		return
+	}
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(fw.dirKeys, dir)
+		if err := fw.w.Remove(dir); err != nil && !errors.Is(err, fsnotify.ErrNonExistentWatch) {
+			fw.log.V(1).Info("Error removing watch", "path", dir, "error", err.Error())
+		}
+	}
+}
+
+// existingAncestor returns dir, or the closest directory above it that
+// exists, going no higher than top.
+func existingAncestor(dir, top string) string {
+	for dir != top && dir != filepath.Dir(dir) {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// watchDirs returns the on-disk directories to watch for a scan of paths that
+// recorded files: every scanned directory plus the directory holding each
+// scan root, so that the root itself appearing or disappearing is noticed.
+// When a root does not exist yet, its nearest existing ancestor is watched
+// instead; each directory created on the way to it triggers a reconcile that
+// moves the watch one step closer.
+func watchDirs(paths []string, opts scanOptions, files []FileInfo) []string {
+	var dirs []string
+	for _, path := range paths {
+		var root string
+		if isPattern(path) {
+			root, _ = patternRoot(path)
+		} else {
+			root = filepath.Clean(path)
+		}
+		root = opts.physical(root)
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			root = existingAncestor(filepath.Dir(root), opts.physical("/"))
+		}
+		dirs = append(dirs, root)
+	}
+	for _, f := range files {
+		if f.IsDir {
+			dirs = append(dirs, opts.physical(f.Path))
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchErrorBackoff paces the restarts of a FileMonitor informer's watch after
+// it fails, on top of the reflector's own backoff, so that an API server that
+// is being upgraded is not hit by every informer as soon as it is back.
+var watchErrorBackoff = wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: math.MaxInt32, Cap: time.Minute}
+
+// watchErrorReset is how long a watch must go without failing for
+// watchErrorBackoff to start over.
+const watchErrorReset = 2 * time.Minute
+
+// watchErrorHandler returns the handler of the watch errors of the FileMonitor
+// informer for version in namespace, which counts and logs each one. A watch
+// whose resourceVersion has expired is left to the reflector, which relists
+// straight away from the latest resourceVersion; any other failure is backed
+// off before the informer lists and watches again. The reflector calls the
+// handler from a single goroutine, between attempts.
+func (c *Controller) watchErrorHandler(namespace, version string) cache.WatchErrorHandlerWithContext {
+	log := c.log.WithValues("namespace", namespace, "version", version)
+	backoff := watchErrorBackoff
+	var last time.Time
+	return func(ctx context.Context, _ *cache.Reflector, err error) {
+		switch {
+		case errors.Is(err, io.EOF):
+			// The watch was closed normally.
+			return
+		case apierrors.IsResourceExpired(err) || apierrors.IsGone(err):
+			watchErrors.WithLabelValues(watchErrorExpired).Inc()
+			log.V(1).Info("FileMonitor watch expired, relisting", "error", err.Error())
+			return
+		}
+
+		watchErrors.WithLabelValues(watchErrorOther).Inc()
+		if time.Since(last) > watchErrorReset {
+			backoff = watchErrorBackoff
+		}
+		last = time.Now()
+		delay := backoff.Step()
+		log.Error(err, "FileMonitor watch failed, backing off before relisting", "backoff", delay.String())
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+}
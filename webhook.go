@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// defaultWebhookAddr is the default for --webhook-addr.
+const defaultWebhookAddr = ":9443"
+
+// webhookPath is where the validating admission webhook is served.
+const webhookPath = "/validate-filemonitor"
+
+// maxAdmissionReviewSize bounds the body of an AdmissionReview request. The API
+// server never sends objects larger than its own 3MiB request limit.
+const maxAdmissionReviewSize = 3 << 20
+
+// handleValidate implements the AdmissionReview contract for FileMonitor
+// creates and updates, refusing any object whose spec fails validateSpec.
+func handleValidate(log logr.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxAdmissionReviewSize))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("reading request: %v", err), http.StatusBadRequest)
+			return
+		}
+		var review admissionv1.AdmissionReview
+		if err := json.Unmarshal(body, &review); err != nil {
+			http.Error(w, fmt.Sprintf("decoding AdmissionReview: %v", err), http.StatusBadRequest)
+			return
+		}
+		if review.Request == nil {
+			http.Error(w, "AdmissionReview has no request", http.StatusBadRequest)
+			return
+		}
+
+		response := admitFileMonitor(review.Request)
+		if !response.Allowed {
+			log.Info("Rejected FileMonitor", "namespace", review.Request.Namespace, "name", review.Request.Name,
+				"operation", review.Request.Operation, "reason", response.Result.Message)
+		}
+
+		review.Response = response
+		review.Request = nil
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(&review); err != nil {
+			log.Error(err, "Error writing AdmissionReview response")
+		}
+	}
+}
+
+// admitFileMonitor decides a single admission request, whose spec may use the
+// field names of either version. Operations other than create and update are
+// always allowed.
+func admitFileMonitor(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+	if req.Operation != admissionv1.Create && req.Operation != admissionv1.Update {
+		return response
+	}
+
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(req.Object.Raw); err != nil {
+		return deny(response, http.StatusBadRequest, fmt.Sprintf("decoding FileMonitor: %v", err))
+	}
+	fm, err := decodeFileMonitor(u)
+	if err != nil {
+		return deny(response, http.StatusBadRequest, err.Error())
+	}
+	if err := validateSpec(fm.Spec); err != nil {
+		return deny(response, http.StatusUnprocessableEntity, err.Error())
+	}
+	return response
+}
+
+// deny turns response into a refusal with the given HTTP code and message,
+// which kubectl shows to the user.
+func deny(response *admissionv1.AdmissionResponse, code int32, message string) *admissionv1.AdmissionResponse {
+	response.Allowed = false
+	response.Result = &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    code,
+		Reason:  metav1.StatusReasonInvalid,
+		Message: message,
+	}
+	return response
+}
+
+// serveWebhook serves the validating admission webhook over HTTPS on addr
+// until ctx is cancelled.
+func serveWebhook(ctx context.Context, log logr.Logger, addr, certFile, keyFile string) {
+	mux := http.NewServeMux()
+	mux.Handle(webhookPath, handleValidate(log))
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Error(err, "Error shutting down webhook server")
+		}
+	}()
+
+	log.Info("Serving validating webhook", "addr", addr, "path", webhookPath)
+	if err := srv.ListenAndServeTLS(certFile, keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error(err, "Webhook server failed")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/websocket"
+)
+
+// webSocketPath is where the WebSocket change stream is served.
+const webSocketPath = "/ws/changes"
+
+// WebSocket keepalive settings. Each connection is pinged every
+// webSocketPingPeriod and dropped when no pong arrives within
+// webSocketPongWait; a write that takes longer than webSocketWriteWait means
+// the client is gone.
+const (
+	webSocketWriteWait  = 10 * time.Second
+	webSocketPongWait   = 60 * time.Second
+	webSocketPingPeriod = webSocketPongWait * 9 / 10
+)
+
+// webSocketUpgrader keeps gorilla's default same-origin check, so that pages
+// served elsewhere cannot read the stream through a visitor's browser.
+var webSocketUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// webSocketHandler streams the changes published to feed to WebSocket
+// clients as JSON feedEvent messages. The namespace and name query
+// parameters restrict a stream to matching FileMonitors.
+type webSocketHandler struct {
+	log  logr.Logger
+	feed *changeFeed
+}
+
+func (h *webSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	namespace, name := r.URL.Query().Get("namespace"), r.URL.Query().Get("name")
+	conn, err := webSocketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already replied with an error.
+		h.log.V(1).Info("WebSocket upgrade failed", "remote", r.RemoteAddr, "error", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	sub := h.feed.subscribe(namespace, name, webSocketChangesDropped)
+	defer h.feed.unsubscribe(sub)
+
+	h.log.V(1).Info("WebSocket stream opened", "remote", r.RemoteAddr, "namespace", namespace, "name", name)
+	defer h.log.V(1).Info("WebSocket stream closed", "remote", r.RemoteAddr, "namespace", namespace, "name", name)
+
+	// Clients only ever send control frames, but they must be read for
+	// pongs and the close handshake to be processed.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		conn.SetReadLimit(512)
+		_ = conn.SetReadDeadline(time.Now().Add(webSocketPongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(webSocketPongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(webSocketPingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case <-gone:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(webSocketWriteWait)); err != nil {
+				return
+			}
+		case ev, ok := <-sub.ch:
+			if !ok {
+				msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "controller is shutting down")
+				_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(webSocketWriteWait))
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(webSocketWriteWait))
+			if err := conn.WriteJSON(ev); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// serveWebSocket serves the WebSocket change stream on addr until ctx is
+// cancelled, then closes feed so open streams end before the server stops.
+func serveWebSocket(ctx context.Context, log logr.Logger, addr string, feed *changeFeed) {
+	mux := http.NewServeMux()
+	mux.Handle(webSocketPath, &webSocketHandler{log: log, feed: feed})
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		// Shutdown does not wait for hijacked connections; closing the feed
+		// ends their streams.
+		feed.close()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Error(err, "Error shutting down WebSocket server")
+		}
+	}()
+
+	log.Info("Serving WebSocket file change stream", "addr", addr, "path", webSocketPath)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error(err, "WebSocket server failed")
+	}
+}
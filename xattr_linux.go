@@ -0,0 +1,80 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"syscall"
+	"unicode/utf8"
+)
+
+// xattrsSupported reports whether readXattrs can return extended attributes
+// on this platform.
+const xattrsSupported = true
+
+// readXattrs returns the extended attributes of path. Values are returned as
+// text with any trailing NUL removed when they are valid UTF-8, and as "0s"
+// followed by their base64 encoding otherwise. A filesystem without extended
+// attribute support yields no attributes and no error.
+func readXattrs(path string) (map[string]string, error) {
+	list, err := xattrCall(func(buf []byte) (int, error) { return syscall.Listxattr(path, buf) })
+	if err != nil {
+		if errors.Is(err, syscall.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var xattrs map[string]string
+	for _, name := range bytes.Split(list, []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attr := string(name)
+		value, err := xattrCall(func(buf []byte) (int, error) { return syscall.Getxattr(path, attr, buf) })
+		if err != nil {
+			// Removed since it was listed, or not readable by us.
+			continue
+		}
+		if xattrs == nil {
+			xattrs = make(map[string]string)
+		}
+		xattrs[attr] = xattrValue(value)
+	}
+	return xattrs, nil
+}
+
+// xattrCall runs a Listxattr or Getxattr style call, first asking for the
+// size needed and then reading into a buffer of that size, retrying if the
+// value grew in between.
+func xattrCall(call func(buf []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := call(nil)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size)
+		n, err := call(buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+// xattrValue renders an attribute value as described on readXattrs.
+func xattrValue(value []byte) string {
+	text := bytes.TrimSuffix(value, []byte{0})
+	if utf8.Valid(text) && bytes.IndexByte(text, 0) < 0 {
+		return string(text)
+	}
+	return "0s" + base64.StdEncoding.EncodeToString(value)
+}
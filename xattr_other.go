@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+// xattrsSupported reports whether readXattrs can return extended attributes
+// on this platform.
+const xattrsSupported = false
+
+// readXattrs never returns any attributes outside Linux.
+func readXattrs(path string) (map[string]string, error) {
+	return nil, nil
+}